@@ -0,0 +1,537 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Representation of AR files.
+
+package archive
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+// The first bytes of a regular archive, and of a thin archive.
+const (
+	AR_MAGIC      = "!<arch>\n"
+	THIN_AR_MAGIC = "!<thin>\n"
+)
+
+// Names of special members in the variants of the archive format.
+const (
+	// The GNU symbol table with 64-bit offsets, for very large archives.
+	GNU_SYMTAB64_NAME = "/SYM64/"
+	// The BSD symbol tables, which may also have a " SORTED" suffix.
+	BSD_SYMTAB_NAME   = "__.SYMDEF"
+	BSD_SYMTAB64_NAME = "__.SYMDEF_64"
+	// Prefix of a BSD long filename, which is followed by the length.
+	BSD_LONG_NAME_PREFIX = "#1/"
+)
+
+type ARFileHeader struct {
+	Filename  string // Offset 0, up to 16 chars for short names.
+	Timestamp string // Offset 16
+	OwnerID   string // Offset 28
+	GroupID   string // Offset 34
+	FileMode  string // Offset 40
+	FileSize  uint32 // Offset 48
+}
+
+func (h *ARFileHeader) String() string {
+	return fmt.Sprintf("{Filename: %s\n Timestamp: %s\n OwnerID: %s\n "+
+		"GroupID: %s\n FileMode: %s\n FileSize: %d}\n",
+		h.Filename, h.Timestamp, h.OwnerID, h.GroupID,
+		h.FileMode, h.FileSize)
+}
+
+type ARFileHeaderContents struct {
+	Header   ARFileHeader
+	Contents []byte
+	Offset   int64 // Offset of the member header in the archive.
+}
+
+// An entry of the archive symbol table: a global symbol, and the
+// member which defines it.
+type ARSymbol struct {
+	Name   string
+	Member int // Index into ARFile.Members.
+}
+
+type ARFile struct {
+	// The file name of the archive.
+	Name string
+	// The members, in archive order. Several members may have the
+	// same name (e.g., util.o from different directories).
+	Members []ARFileHeaderContents
+	// The archive symbol table, in order.
+	// Empty if the archive doesn't have one.
+	Symbols []ARSymbol
+	// Symbol name -> member index, for the first definition in Symbols.
+	symbol_map map[string]int
+	// Member name -> indices of the members with that name, in order.
+	name_index map[string][]int
+	// Member header offset -> member index.
+	member_offsets map[int64]int
+}
+
+// Specialized AR file holding only ELF files.
+type ARElfFile struct {
+	Header ARFileHeader
+	File   elffile.ElfFile
+}
+
+// Translate the name field of a member header. Long filenames (and the
+// paths of thin archive members) are "/offset" into the long-filename
+// file, where each name ends with "/\n". Thin archives may also have
+// "/offset:member_offset" (see readThinMember).
+func translateFilename(fname string, lf_file []byte) (string, error) {
+	if fname[0] == '/' {
+		// It's a long filename, which is /[0-9]+, or one of the special files.
+		fname = strings.TrimSpace(fname)
+		if fname == "/" || fname == "//" || fname == GNU_SYMTAB64_NAME {
+			return fname, nil
+		}
+		if colon := strings.IndexByte(fname, ':'); colon >= 0 {
+			fname = fname[:colon]
+		}
+		offset, err := strconv.Atoi(fname[1:])
+		if err != nil {
+			return "", fmt.Errorf("bad long filename offset %s", fname)
+		}
+		if offset < 0 || offset > len(lf_file) {
+			return "", fmt.Errorf("long filename offset out of range: %s", fname)
+		}
+		end := bytes.Index(lf_file[offset:], []byte("/\n"))
+		if end < 0 {
+			return "", fmt.Errorf("unterminated long filename at offset %s",
+				fname)
+		}
+		return string(lf_file[offset : offset+end]), nil
+	} else {
+		// GNU short names end with a '/', but BSD ones are just padded.
+		if end := strings.IndexByte(fname, '/'); end >= 0 {
+			return fname[:end], nil
+		}
+		return strings.TrimRight(fname, " "), nil
+	}
+}
+
+// BSD archives put long filenames (and ones with spaces) at the start of
+// the member body instead, with a "#1/length" name field. Get the length.
+func bsdNameLength(fname string) (int, bool, error) {
+	fname = strings.TrimSpace(fname)
+	if !strings.HasPrefix(fname, BSD_LONG_NAME_PREFIX) {
+		return 0, false, nil
+	}
+	length, err := strconv.Atoi(fname[len(BSD_LONG_NAME_PREFIX):])
+	if err != nil || length < 0 {
+		return 0, false, fmt.Errorf("bad BSD long filename length: %s", fname)
+	}
+	return length, true, nil
+}
+
+// For a thin archive member named "/offset:member_offset", get the
+// member_offset.
+func thinNestedOffset(fname string) (int64, bool, error) {
+	fname = strings.TrimSpace(fname)
+	colon := strings.IndexByte(fname, ':')
+	if !strings.HasPrefix(fname, "/") || colon < 0 {
+		return 0, false, nil
+	}
+	offset, err := strconv.ParseInt(fname[colon+1:], 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("bad thin archive member offset %s", fname)
+	}
+	return offset, true, nil
+}
+
+// Read a word_size (4 or 8) byte integer.
+func readARWord(order binary.ByteOrder, buf []byte, word_size int) uint64 {
+	if word_size == 8 {
+		return order.Uint64(buf)
+	}
+	return uint64(order.Uint32(buf))
+}
+
+// Parse the GNU symbol table: a big-endian count, the file offsets of the
+// member headers (one per symbol), then the NUL-terminated symbol names.
+// The words are 4 bytes, or 8 bytes for the /SYM64/ table.
+// Returns the symbol names, and the member header offset of each symbol.
+func parseGNUSymbolTable(buf []byte, word_size int) ([]string, []uint64,
+	error) {
+	if len(buf) < word_size {
+		return nil, nil, errors.New("archive symbol table is too small")
+	}
+	order := binary.BigEndian
+	count := readARWord(order, buf, word_size)
+	if count > uint64(len(buf)/word_size) {
+		return nil, nil, fmt.Errorf("archive symbol table has %d entries, "+
+			"but only %d bytes", count, len(buf))
+	}
+	names_start := uint64(word_size) * (1 + count)
+	if names_start > uint64(len(buf)) {
+		return nil, nil, fmt.Errorf("archive symbol table has %d entries, "+
+			"but only %d bytes", count, len(buf))
+	}
+	offsets := make([]uint64, count)
+	for i := range offsets {
+		offsets[i] = readARWord(order, buf[word_size*(1+i):], word_size)
+	}
+	names := make([]string, 0, count)
+	strtab := buf[names_start:]
+	for i := uint64(0); i < count; i++ {
+		end := bytes.IndexByte(strtab, 0)
+		if end < 0 {
+			return nil, nil, errors.New(
+				"archive symbol table names are not NUL-terminated")
+		}
+		names = append(names, string(strtab[:end]))
+		strtab = strtab[end+1:]
+	}
+	return names, offsets, nil
+}
+
+// Parse the BSD symbol table (__.SYMDEF): the size in bytes of an array of
+// (name offset, member header offset) pairs, the array, then the size of
+// the string table and the NUL-terminated names. The words are 4 bytes,
+// or 8 bytes for __.SYMDEF_64. They are little-endian, as llvm-ar and
+// the Darwin tools write them for the targets we handle.
+// Returns the symbol names, and the member header offset of each symbol.
+func parseBSDSymbolTable(buf []byte, word_size int) ([]string, []uint64,
+	error) {
+	order := binary.LittleEndian
+	if len(buf) < word_size {
+		return nil, nil, errors.New("archive symbol table is too small")
+	}
+	ranlib_size := readARWord(order, buf, word_size)
+	ranlib_end := uint64(word_size) + ranlib_size
+	if ranlib_size%uint64(2*word_size) != 0 ||
+		ranlib_size > uint64(len(buf)) ||
+		ranlib_end+uint64(word_size) > uint64(len(buf)) {
+		return nil, nil, fmt.Errorf("archive symbol table has %d bytes of "+
+			"entries, but only %d bytes", ranlib_size, len(buf))
+	}
+	strtab_size := readARWord(order, buf[ranlib_end:], word_size)
+	strtab_start := ranlib_end + uint64(word_size)
+	if strtab_size > uint64(len(buf))-strtab_start {
+		return nil, nil, fmt.Errorf("archive symbol table names have %d "+
+			"bytes, but only %d bytes are left", strtab_size,
+			uint64(len(buf))-strtab_start)
+	}
+	strtab := buf[strtab_start : strtab_start+strtab_size]
+	count := ranlib_size / uint64(2*word_size)
+	names := make([]string, 0, count)
+	offsets := make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		entry := buf[uint64(word_size)*(1+2*i):]
+		strx := readARWord(order, entry, word_size)
+		if strx >= uint64(len(strtab)) {
+			return nil, nil, fmt.Errorf("archive symbol table name offset %d "+
+				"is out of range", strx)
+		}
+		end := bytes.IndexByte(strtab[strx:], 0)
+		if end < 0 {
+			return nil, nil, errors.New(
+				"archive symbol table names are not NUL-terminated")
+		}
+		names = append(names, string(strtab[strx:strx+uint64(end)]))
+		offsets = append(offsets, readARWord(order, entry[word_size:], word_size))
+	}
+	return names, offsets, nil
+}
+
+// Parse the symbol table member, if filename is the name of one.
+func parseSymbolTable(filename string, buf []byte) ([]string, []uint64, bool,
+	error) {
+	var names []string
+	var offsets []uint64
+	var err error
+	switch filename {
+	case "/":
+		names, offsets, err = parseGNUSymbolTable(buf, 4)
+	case GNU_SYMTAB64_NAME:
+		names, offsets, err = parseGNUSymbolTable(buf, 8)
+	case BSD_SYMTAB_NAME, BSD_SYMTAB_NAME + " SORTED":
+		names, offsets, err = parseBSDSymbolTable(buf, 4)
+	case BSD_SYMTAB64_NAME, BSD_SYMTAB64_NAME + " SORTED":
+		names, offsets, err = parseBSDSymbolTable(buf, 8)
+	default:
+		return nil, nil, false, nil
+	}
+	return names, offsets, true, err
+}
+
+// Get the contents of a thin archive member, which are in a separate
+// file, relative to the thin archive's directory. When an archive is
+// added to a thin archive, its members are named "/offset:member_offset",
+// where offset is the path of the nested archive in the long-filename
+// file, and member_offset is the offset of the member's header within
+// the nested archive. Those members are named "nested.a(member.o)".
+// Nested archives are read once, and cached in nested.
+func readThinMember(dir string, path string, raw_name string,
+	nested map[string]ARFile) (string, []byte, error) {
+	full_path := path
+	if !filepath.IsAbs(full_path) {
+		full_path = filepath.Join(dir, path)
+	}
+	member_offset, is_nested, err := thinNestedOffset(raw_name)
+	if err != nil {
+		return "", nil, err
+	}
+	if !is_nested {
+		contents, err := ioutil.ReadFile(full_path)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read thin archive member: %s",
+				err)
+		}
+		return path, contents, nil
+	}
+	ar_file, ok := nested[full_path]
+	if !ok {
+		contents, err := ioutil.ReadFile(full_path)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot open nested archive: %s", err)
+		}
+		if !bytes.HasPrefix(contents, []byte(AR_MAGIC)) {
+			// ar flattens thin archives which are added to thin archives,
+			// and reading them could loop forever.
+			return "", nil, fmt.Errorf("nested archive %s is not a regular "+
+				"archive", full_path)
+		}
+		ar_file, err = ReadPlainARFile(bytes.NewReader(contents),
+			int64(len(contents)), full_path)
+		if err != nil {
+			return "", nil, err
+		}
+		nested[full_path] = ar_file
+	}
+	member, ok := ar_file.member_offsets[member_offset]
+	if !ok {
+		return "", nil, fmt.Errorf("no member at offset %d of nested "+
+			"archive %s", member_offset, full_path)
+	}
+	return path + "(" + ar_file.Members[member].Header.Filename + ")",
+		ar_file.Members[member].Contents, nil
+}
+
+// Read the members of a regular or thin archive of size bytes, named name.
+// Errors are *InputErrors, with the offset of the bad member header.
+func readARMembers(r io.ReaderAt, size int64, name string, thin bool) (
+	ARFile, error) {
+	ar_file := ARFile{Name: name, symbol_map: make(map[string]int),
+		name_index:     make(map[string][]int),
+		member_offsets: make(map[int64]int)}
+	var symtab_names []string
+	var symtab_offsets []uint64
+	dir := filepath.Dir(name)
+	nested := make(map[string]ARFile)
+	per_file_header_size := 60
+	hbuf := make([]byte, per_file_header_size)
+	// Assume magic number header is already read.
+	offset := int64(len(AR_MAGIC))
+	special_long_filename_file := make([]byte, 0)
+	fail := func(offset int64, err error) (ARFile, error) {
+		return ARFile{}, elffile.InFile(&elffile.InputError{Offset: offset, Err: err},
+			name)
+	}
+	// Go through the AR, reading more and more file-headers + file-bodies.
+	for {
+		n, err := r.ReadAt(hbuf, offset)
+		if err == io.EOF && n == 0 {
+			break
+		}
+		if err != nil {
+			return fail(offset, fmt.Errorf("cannot read member header: %s "+
+				"(read %d bytes)", err, n))
+		}
+		// Okay, hbuf now has the header contents.
+		header_offset := offset
+		offset += int64(n)
+		fsize, err := strconv.Atoi(strings.TrimSpace(string(hbuf[48:58])))
+		if err != nil {
+			return fail(header_offset, fmt.Errorf("bad member size %q",
+				strings.TrimSpace(string(hbuf[48:58]))))
+		}
+		filename, err := translateFilename(string(hbuf[0:16]),
+			special_long_filename_file)
+		if err != nil {
+			return fail(header_offset, err)
+		}
+		new_header := ARFileHeader{
+			Filename:  filename,
+			Timestamp: strings.TrimSpace(string(hbuf[16:28])),
+			OwnerID:   strings.TrimSpace(string(hbuf[28:34])),
+			GroupID:   strings.TrimSpace(string(hbuf[34:40])),
+			FileMode:  strings.TrimSpace(string(hbuf[40:48])),
+			FileSize:  uint32(fsize)}
+		var body_buf []byte
+		if thin && filename != "/" && filename != "//" &&
+			filename != GNU_SYMTAB64_NAME {
+			// The member isn't stored in the thin archive itself.
+			filename, body_buf, err = readThinMember(dir, filename,
+				string(hbuf[0:16]), nested)
+			if err != nil {
+				return fail(header_offset, err)
+			}
+			new_header.Filename = filename
+			fsize = 0
+		} else {
+			if fsize < 0 || int64(fsize) > size-offset {
+				return fail(header_offset, fmt.Errorf("member size %d runs "+
+					"past the end of the archive (%d bytes)", fsize, size))
+			}
+			body_buf = make([]byte, fsize)
+			_, err2 := r.ReadAt(body_buf, offset)
+			if err2 != nil {
+				return fail(header_offset, fmt.Errorf("cannot read member "+
+					"%s: %s", filename, err2))
+			}
+		}
+		name_length, is_bsd_name, err := bsdNameLength(string(hbuf[0:16]))
+		if err != nil {
+			return fail(header_offset, err)
+		}
+		if is_bsd_name {
+			if name_length > len(body_buf) {
+				return fail(header_offset, fmt.Errorf("BSD long filename "+
+					"length %d is larger than the member (%d bytes)",
+					name_length, len(body_buf)))
+			}
+			// The name may be padded with NULs.
+			filename = strings.TrimRight(string(body_buf[:name_length]), "\x00")
+			body_buf = body_buf[name_length:]
+			new_header.Filename = filename
+			new_header.FileSize = uint32(len(body_buf))
+		}
+		names, offsets, ok, err := parseSymbolTable(filename, body_buf)
+		if err != nil {
+			return fail(header_offset, err)
+		}
+		if ok {
+			// This is the special symbol-table file.
+			// (not adding it to the ar_file map)
+			symtab_names, symtab_offsets = names, offsets
+		} else if filename == "//" {
+			// This is the long-filename file.
+			// (not adding it to the ar_file map)
+			special_long_filename_file = append(special_long_filename_file,
+				body_buf...)
+		} else {
+			// Normal file, index it!
+			index := len(ar_file.Members)
+			ar_file.Members = append(ar_file.Members,
+				ARFileHeaderContents{new_header, body_buf, header_offset})
+			ar_file.name_index[filename] = append(ar_file.name_index[filename],
+				index)
+			ar_file.member_offsets[header_offset] = index
+		}
+		offset += int64(fsize)
+		// Data section should be aligned to 2 bytes.
+		if offset%2 != 0 {
+			offset += 1
+		}
+	}
+	for i, name := range symtab_names {
+		member, ok := ar_file.member_offsets[int64(symtab_offsets[i])]
+		if !ok {
+			return ARFile{}, elffile.FileError(name, "archive symbol table entry "+
+				"%s has a bad member offset: %d", name, symtab_offsets[i])
+		}
+		ar_file.Symbols = append(ar_file.Symbols, ARSymbol{name, member})
+		if _, ok := ar_file.symbol_map[name]; !ok {
+			ar_file.symbol_map[name] = member
+		}
+	}
+	return ar_file, nil
+}
+
+// Read a regular archive of size bytes, in the GNU or BSD variant of the
+// format. The name is for errors (and ARFile.Name).
+func ReadPlainARFile(r io.ReaderAt, size int64, name string) (ARFile, error) {
+	return readARMembers(r, size, name, false)
+}
+
+// Read a thin archive ("!<thin>"), loading the members from their own
+// files, which are relative to the directory of name. The result is the
+// same as for a regular archive.
+func ReadThinARFile(r io.ReaderAt, size int64, name string) (ARFile, error) {
+	return readARMembers(r, size, name, true)
+}
+
+// The first member with the given name.
+func (f *ARFile) Member(name string) (*ARFileHeaderContents, bool) {
+	indices := f.name_index[name]
+	if len(indices) == 0 {
+		return nil, false
+	}
+	return &f.Members[indices[0]], true
+}
+
+// The indices of all the members with the given name, in archive order.
+func (f *ARFile) MembersNamed(name string) []int {
+	return f.name_index[name]
+}
+
+// The index of the member which defines the symbol, according to the
+// archive symbol table. If several members define it, this is the first.
+func (f *ARFile) MemberDefining(sym string) (int, bool) {
+	member, ok := f.symbol_map[sym]
+	return member, ok
+}
+
+// Compare the archive symbol table with the real symbols of a member,
+// describing any differences (e.g., because the archive was changed
+// without updating the symbol table with ranlib).
+func (f *ARFile) CheckSymbolIndex(member int, st elffile.SymbolTable) []string {
+	problems := []string{}
+	name := f.Members[member].Header.Filename
+	indexed := make(map[string]bool)
+	for _, entry := range f.Symbols {
+		if entry.Member == member {
+			indexed[entry.Name] = true
+		}
+	}
+	defined := make(map[string]bool)
+	for i := 1; i < len(st); i++ {
+		sym := &st[i]
+		if sym.St_shndx == elf.SHN_UNDEF ||
+			elffile.GetSymBind(sym.St_info) == elf.STB_LOCAL {
+			continue
+		}
+		defined[sym.St_name] = true
+		if !indexed[sym.St_name] {
+			problems = append(problems, fmt.Sprintf(
+				"%s defines %s, which is missing from the archive index",
+				name, sym.St_name))
+		}
+	}
+	for _, entry := range f.Symbols {
+		if entry.Member == member && !defined[entry.Name] {
+			problems = append(problems, fmt.Sprintf(
+				"archive index says %s defines %s, but it does not",
+				name, entry.Name))
+		}
+	}
+	return problems
+}
+
+func (f *ARFile) WrapARElf() ([]ARElfFile, error) {
+	result := make([]ARElfFile, len(f.Members))
+	for i, arsubfile := range f.Members {
+		elf_file, err := elffile.ReadElfFile(arsubfile.Contents)
+		if err != nil {
+			return nil, elffile.InMember(err, f.Name, arsubfile.Header.Filename)
+		}
+		result[i] = ARElfFile{Header: arsubfile.Header, File: elf_file}
+	}
+	return result, nil
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Test AR file utilities.
+
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/jvoung/go-ld/elffile"
+	. "github.com/jvoung/go-ld/internal/testutil"
+	. "github.com/jvoung/go-ld/internal/testutil/elftest"
+)
+
+// Test an archive with elf files.
+// This has a GNU symbol table.
+func TestELFARFileStructure(t *testing.T) {
+	test_name := path.Join(TestX8632BaseDir(), "libcrt_platform.a")
+	expected_subfiles := map[string]bool{
+		"pnacl_irt.o": true,
+		"setjmp.o":    true,
+		"string.o":    true}
+	ar_file := readARFileForTest(t, test_name)
+	ExpectEq(t, len(expected_subfiles), len(ar_file.Members))
+	// Check that the contents are really ELF.
+	for _, member := range ar_file.Members {
+		ExpectEq(t, string(member.Contents[0:len(elffile.ELF_MAGIC)]), elffile.ELF_MAGIC)
+		ExpectEq(t, expected_subfiles[member.Header.Filename], true)
+	}
+}
+
+// Test an archive with text files.
+// This has long filenames and files with a space in the name.
+func TestLongFilenames(t *testing.T) {
+	checkLongFilenames(t, path.Join(TestLibDir(), "liblong_filename.a"))
+}
+
+// The same, in a BSD archive, which has the names in the member bodies.
+func TestLongFilenamesBSD(t *testing.T) {
+	checkLongFilenames(t, path.Join(TestLibDir(), "liblong_filename_bsd.a"))
+}
+
+func checkLongFilenames(t *testing.T, test_name string) {
+	expected_subfiles := []string{
+		"file_11.txt",
+		"file_24.txt",
+		"file_nil.txt",
+		"file_quick_brown_fox_jumped.txt",
+		"file with space in it.txt"}
+	expected_contents := map[string]string{
+		"file_11.txt":  "0123456789\n",
+		"file_24.txt":  "55555\n55555\n55555\n55555\n",
+		"file_nil.txt": "",
+		"file_quick_brown_fox_jumped.txt": "the quick brown fox " +
+			"jumps over the lazy dog\n",
+		"file with space in it.txt": "This file has a space in its name.\n"}
+	ar_file := readARFileForTest(t, test_name)
+	AssertEq(t, len(expected_subfiles), len(ar_file.Members))
+	// The members are in archive order.
+	for i, member := range ar_file.Members {
+		fname := member.Header.Filename
+		ExpectEq(t, expected_subfiles[i], fname)
+		ec := expected_contents[fname]
+		ExpectEq(t, uint32(len(ec)), member.Header.FileSize)
+		ExpectEq(t, ec, string(member.Contents))
+	}
+}
+
+func readARFileForTest(t *testing.T, fname string) ARFile {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal("Failed to read test AR file", fname, err)
+	}
+	ar_file, err := ReadPlainARFile(bytes.NewReader(buf), int64(len(buf)),
+		fname)
+	AssertNoError(t, err)
+	return ar_file
+}
+
+// The GNU symbol table maps each global symbol to its member.
+func TestARSymbolTable(t *testing.T) {
+	ar_file := checkARSymbolTable(t,
+		path.Join(TestX8632BaseDir(), "libcrt_platform.a"))
+
+	// The archive with text files has no symbol table.
+	ar_file = readARFileForTest(t, path.Join(TestLibDir(), "liblong_filename.a"))
+	ExpectEq(t, 0, len(ar_file.Symbols))
+}
+
+// The BSD __.SYMDEF and GNU /SYM64/ symbol tables are read the same way.
+func TestARSymbolTableVariants(t *testing.T) {
+	for _, name := range []string{"libcrt_platform_bsd.a",
+		"libcrt_platform_sym64.a"} {
+		checkARSymbolTable(t, path.Join(TestX8632BaseDir(), name))
+	}
+}
+
+func checkARSymbolTable(t *testing.T, fname string) ARFile {
+	ar_file := readARFileForTest(t, fname)
+	members := []string{"pnacl_irt.o", "setjmp.o", "string.o"}
+	AssertEq(t, len(members), len(ar_file.Members))
+	for i := range members {
+		ExpectEq(t, members[i], ar_file.Members[i].Header.Filename)
+	}
+	expected := []ARSymbol{
+		{"__nacl_read_tp", 0},
+		{"__pnacl_init_irt", 0},
+		{"longjmp", 1},
+		{"setjmp", 1},
+		{"memcpy", 2},
+		{"memmove", 2},
+		{"memset", 2}}
+	AssertEq(t, len(expected), len(ar_file.Symbols))
+	for i := range expected {
+		ExpectEq(t, expected[i], ar_file.Symbols[i])
+	}
+	member, ok := ar_file.MemberDefining("memmove")
+	ExpectEq(t, true, ok)
+	ExpectEq(t, 2, member)
+	_, ok = ar_file.MemberDefining("printf")
+	ExpectEq(t, false, ok)
+	return ar_file
+}
+
+func TestARSymbolTableStale(t *testing.T) {
+	ar_file := readARFileForTest(t,
+		path.Join(TestX8632BaseDir(), "libcrt_platform.a"))
+	member, ok := ar_file.Member("string.o")
+	AssertEq(t, true, ok)
+	elf_file := ReadElfFileForTest(member.Contents)
+	st := ReadSymbolsForTest(elf_file)
+	ExpectEq(t, 0, len(ar_file.CheckSymbolIndex(2, st)))
+
+	// Pretend that string.o was rebuilt, and memset renamed to bzero.
+	for i := range st {
+		if st[i].St_name == "memset" {
+			st[i].St_name = "bzero"
+		}
+	}
+	problems := ar_file.CheckSymbolIndex(2, st)
+	AssertEq(t, 2, len(problems))
+	ExpectEq(t, "string.o defines bzero, which is missing from the "+
+		"archive index", problems[0])
+	ExpectEq(t, "archive index says string.o defines memset, but it does not",
+		problems[1])
+}
+
+// A thin archive only has the member headers, and the members are read
+// from the files next to it. Most of its members come from other archives.
+func TestThinARFileMembers(t *testing.T) {
+	test_name := path.Join(TestX8632BaseDir(), "libthin_nested.a")
+	buf, err := ioutil.ReadFile(test_name)
+	if err != nil {
+		t.Fatal("Failed to read test AR file", err)
+	}
+	ar_file, err := ReadThinARFile(bytes.NewReader(buf), int64(len(buf)),
+		test_name)
+	AssertNoError(t, err)
+
+	crtbegin, ok := ar_file.Member("crtbegin.o")
+	AssertEq(t, true, ok)
+	ExpectEq(t, elffile.ELF_MAGIC, string(crtbegin.Contents[0:len(elffile.ELF_MAGIC)]))
+
+	libgcc := readARFileForTest(t, path.Join(TestX8632BaseDir(), "libgcc.a"))
+	for _, member := range libgcc.Members {
+		fname := member.Header.Filename
+		thin_member, ok := ar_file.Member("libgcc.a(" + fname + ")")
+		AssertEqM(t, true, ok, fname)
+		ExpectEqM(t, true,
+			bytes.Equal(member.Contents, thin_member.Contents), fname)
+	}
+	member, ok := ar_file.MemberDefining("__udivdi3")
+	ExpectEq(t, true, ok)
+	ExpectEq(t, "libgcc.a(udivdi3.o)", ar_file.Members[member].Header.Filename)
+	member, ok = ar_file.MemberDefining("memcpy")
+	ExpectEq(t, true, ok)
+	ExpectEq(t, "libcrt_platform.a(string.o)",
+		ar_file.Members[member].Header.Filename)
+}
+
+// libthin_all.a was made from older copies of the nested archives, so its
+// member offsets don't point at member headers of the current ones.
+func TestThinARFileStaleOffsets(t *testing.T) {
+	test_name := path.Join(TestX8632BaseDir(), "libthin_all.a")
+	buf, err := ioutil.ReadFile(test_name)
+	if err != nil {
+		t.Fatal("Failed to read test AR file", err)
+	}
+	_, err = ReadThinARFile(bytes.NewReader(buf), int64(len(buf)), test_name)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, test_name+":0x15f8: no member at offset 1786 of nested "+
+		"archive "+path.Join(TestX8632BaseDir(), "libgcc.a"), err.Error())
+}
+
+// Members with the same name are all kept, in archive order.
+func TestDuplicateMemberNames(t *testing.T) {
+	ar_file := readARFileForTest(t, path.Join(TestX8632BaseDir(), "libdup.a"))
+	AssertEq(t, 2, len(ar_file.Members))
+	ExpectEq(t, "util.o", ar_file.Members[0].Header.Filename)
+	ExpectEq(t, "util.o", ar_file.Members[1].Header.Filename)
+	ExpectEq(t, true, ar_file.Members[0].Offset < ar_file.Members[1].Offset)
+	indices := ar_file.MembersNamed("util.o")
+	AssertEq(t, 2, len(indices))
+	ExpectEq(t, 0, indices[0])
+	ExpectEq(t, 1, indices[1])
+	member, ok := ar_file.Member("util.o")
+	AssertEq(t, true, ok)
+	ExpectEq(t, ar_file.Members[0].Offset, member.Offset)
+
+	// Both define util_value, but the first one is the definition.
+	index, ok := ar_file.MemberDefining("util_value")
+	ExpectEq(t, true, ok)
+	ExpectEq(t, 0, index)
+	index, ok = ar_file.MemberDefining("util_second_only")
+	ExpectEq(t, true, ok)
+	ExpectEq(t, 1, index)
+}
+
+// Every ELF archive member in the test directories should come back
+// out of the ELF writer byte-for-byte.
+func TestWriteMembersRoundTrip(t *testing.T) {
+	dirs := []string{TestX8632BaseDir(), TestX8664BaseDir(),
+		TestARMBaseDir(), TestMIPSBaseDir()}
+	checked := 0
+	for _, dir := range dirs {
+		fnames, _ := filepath.Glob(filepath.Join(dir, "*.a"))
+		for _, fname := range fnames {
+			buf, err := ioutil.ReadFile(fname)
+			if err != nil {
+				t.Fatal("Failed to read", fname, err)
+			}
+			if !bytes.HasPrefix(buf, []byte(AR_MAGIC)) {
+				// Thin archive members are checked in their own archives.
+				continue
+			}
+			ar_file := readARFileForTest(t, fname)
+			for _, member := range ar_file.Members {
+				elf_file := ReadElfFileForTest(member.Contents)
+				if !bytes.Equal(member.Contents,
+					elffile.WriteElfFile(&elf_file)) {
+					t.Errorf("%s(%s): Read->Write did not round-trip", fname,
+						member.Header.Filename)
+				}
+				checked++
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("No test archives found")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Serialize an ARFile (member headers, long filenames and symbol table)
+// back to bytes, in the GNU variant of the format. The inverse of the
+// readers in ar_file.go.
+
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Names longer than this (or with a '/', or empty) go in the
+// long-filename member.
+const maxShortNameLength = 15
+
+// Write a 60 byte member header. The fields are padded with spaces, and
+// are an error if they don't fit.
+func writeARHeader(w *bytes.Buffer, name string, h *ARFileHeader,
+	size int) error {
+	fields := []struct {
+		value string
+		width int
+	}{
+		{name, 16},
+		{h.Timestamp, 12},
+		{h.OwnerID, 6},
+		{h.GroupID, 6},
+		{h.FileMode, 8},
+		{strconv.Itoa(size), 10}}
+	for _, field := range fields {
+		if len(field.value) > field.width {
+			return fmt.Errorf("member header field %q is longer than %d "+
+				"bytes", field.value, field.width)
+		}
+		w.WriteString(field.value)
+		w.Write(bytes.Repeat([]byte{' '}, field.width-len(field.value)))
+	}
+	w.WriteString("`\n")
+	return nil
+}
+
+// Write a member with its header, padding the body to 2 bytes.
+func writeARMember(w *bytes.Buffer, name string, h *ARFileHeader,
+	body []byte) error {
+	if err := writeARHeader(w, name, h, len(body)); err != nil {
+		return err
+	}
+	w.Write(body)
+	if len(body)%2 != 0 {
+		w.WriteByte('\n')
+	}
+	return nil
+}
+
+// The GNU symbol table (see parseGNUSymbolTable), given the member header
+// offsets. The words are word_size (4 or 8) bytes.
+func gnuSymbolTable(symbols []ARSymbol, member_offsets []int64,
+	word_size int) []byte {
+	var w bytes.Buffer
+	word := make([]byte, word_size)
+	put := func(v uint64) {
+		if word_size == 8 {
+			binary.BigEndian.PutUint64(word, v)
+		} else {
+			binary.BigEndian.PutUint32(word, uint32(v))
+		}
+		w.Write(word)
+	}
+	put(uint64(len(symbols)))
+	for _, sym := range symbols {
+		put(uint64(member_offsets[sym.Member]))
+	}
+	for _, sym := range symbols {
+		w.WriteString(sym.Name)
+		w.WriteByte(0)
+	}
+	return w.Bytes()
+}
+
+// The size of a member with its header and padding.
+func arMemberSize(body_size int) int64 {
+	return int64(60 + body_size + body_size%2)
+}
+
+// Serialize the archive as a regular GNU archive: the symbol table
+// (if f.Symbols isn't empty, using /SYM64/ if the offsets need it),
+// the long-filename member (if any names need it), then the members in
+// order. Member sizes come from the Contents, not Header.FileSize.
+// Thin archive members are written with their contents, as a regular
+// archive. Errors are for header fields which don't fit.
+func WriteARFile(f *ARFile) ([]byte, error) {
+	for _, sym := range f.Symbols {
+		if sym.Member < 0 || sym.Member >= len(f.Members) {
+			return nil, fmt.Errorf("archive symbol %s is in member %d, but "+
+				"there are only %d members", sym.Name, sym.Member,
+				len(f.Members))
+		}
+	}
+	// The name field of each member, and the long-filename member.
+	names := make([]string, len(f.Members))
+	var long_names bytes.Buffer
+	for i := range f.Members {
+		name := f.Members[i].Header.Filename
+		if name == "" || len(name) > maxShortNameLength ||
+			strings.ContainsRune(name, '/') {
+			names[i] = "/" + strconv.Itoa(long_names.Len())
+			long_names.WriteString(name + "/\n")
+		} else {
+			names[i] = name + "/"
+		}
+	}
+	// Find the member offsets, which depend on the symbol table size.
+	word_size := 4
+	var member_offsets []int64
+	for {
+		offset := int64(len(AR_MAGIC))
+		if len(f.Symbols) != 0 {
+			symtab_size := word_size * (1 + len(f.Symbols))
+			for _, sym := range f.Symbols {
+				symtab_size += len(sym.Name) + 1
+			}
+			offset += arMemberSize(symtab_size)
+		}
+		if long_names.Len() != 0 {
+			offset += arMemberSize(long_names.Len())
+		}
+		member_offsets = make([]int64, len(f.Members))
+		for i := range f.Members {
+			member_offsets[i] = offset
+			offset += arMemberSize(len(f.Members[i].Contents))
+		}
+		if word_size == 4 && len(f.Symbols) != 0 &&
+			member_offsets[len(member_offsets)-1] > 0xffffffff {
+			word_size = 8
+			continue
+		}
+		break
+	}
+
+	var w bytes.Buffer
+	w.WriteString(AR_MAGIC)
+	special := ARFileHeader{Timestamp: "0", OwnerID: "0", GroupID: "0",
+		FileMode: "0"}
+	if len(f.Symbols) != 0 {
+		symtab := gnuSymbolTable(f.Symbols, member_offsets, word_size)
+		symtab_name := "/"
+		if word_size == 8 {
+			symtab_name = GNU_SYMTAB64_NAME
+		}
+		if err := writeARMember(&w, symtab_name, &special, symtab); err != nil {
+			return nil, err
+		}
+	}
+	if long_names.Len() != 0 {
+		if err := writeARMember(&w, "//", &ARFileHeader{},
+			long_names.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	for i := range f.Members {
+		member := &f.Members[i]
+		if err := writeARMember(&w, names[i], &member.Header,
+			member.Contents); err != nil {
+			return nil, fmt.Errorf("member %s: %s", member.Header.Filename,
+				err)
+		}
+	}
+	return w.Bytes(), nil
+}
+
+func WriteARFileFD(f *ARFile, w io.Writer) error {
+	buf, err := WriteARFile(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// Write the archive out as a regular GNU archive.
+func WriteARFileFname(f *ARFile, fname string) error {
+	out, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err := WriteARFileFD(f, out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
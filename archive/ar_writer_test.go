@@ -0,0 +1,102 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test AR file serialization.
+
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func writeARFileForTest(t *testing.T, ar_file *ARFile) []byte {
+	buf, err := WriteARFile(ar_file)
+	AssertNoError(t, err)
+	return buf
+}
+
+// Each regular test archive (GNU or BSD) reads back the same after it
+// is written out, with the same members and symbol table.
+func TestWriteARRoundTrip(t *testing.T) {
+	fnames, _ := filepath.Glob(filepath.Join(TestX8632BaseDir(), "*.a"))
+	libdir_fnames, _ := filepath.Glob(filepath.Join(TestLibDir(), "*.a"))
+	fnames = append(fnames, libdir_fnames...)
+	checked := 0
+	for _, fname := range fnames {
+		orig, err := ioutil.ReadFile(fname)
+		AssertNoError(t, err)
+		if !bytes.HasPrefix(orig, []byte(AR_MAGIC)) {
+			continue
+		}
+		ar_file := readARFileForTest(t, fname)
+		buf := writeARFileForTest(t, &ar_file)
+		out, err := ReadPlainARFile(bytes.NewReader(buf), int64(len(buf)),
+			fname)
+		AssertNoError(t, err)
+		AssertEqM(t, len(ar_file.Members), len(out.Members), fname)
+		for i := range ar_file.Members {
+			ExpectEqM(t, ar_file.Members[i].Header, out.Members[i].Header,
+				fname)
+			ExpectEqM(t, true, bytes.Equal(ar_file.Members[i].Contents,
+				out.Members[i].Contents), fname)
+		}
+		AssertEqM(t, len(ar_file.Symbols), len(out.Symbols), fname)
+		for i := range ar_file.Symbols {
+			ExpectEqM(t, ar_file.Symbols[i], out.Symbols[i], fname)
+		}
+		checked++
+	}
+	if checked < 5 {
+		t.Errorf("Only checked %d archives", checked)
+	}
+
+	// Without a symbol table, GNU ar writes the same bytes.
+	fname := path.Join(TestLibDir(), "liblong_filename.a")
+	orig, err := ioutil.ReadFile(fname)
+	AssertNoError(t, err)
+	ar_file := readARFileForTest(t, fname)
+	ExpectEq(t, true, bytes.Equal(orig, writeARFileForTest(t, &ar_file)))
+}
+
+// Names which don't fit in the header (or have a '/') go in the
+// long-filename member, but the other fields must fit.
+func TestWriteARFileNames(t *testing.T) {
+	header := ARFileHeader{Timestamp: "0", OwnerID: "0", GroupID: "0",
+		FileMode: "644"}
+	ar_file := ARFile{Members: []ARFileHeaderContents{
+		{Header: header, Contents: []byte("odd")},
+		{Header: header, Contents: []byte("even")}}}
+	ar_file.Members[0].Header.Filename = "a.o"
+	ar_file.Members[1].Header.Filename = "dir/sixteen_chars.o"
+	ar_file.Symbols = []ARSymbol{{Name: "even", Member: 1},
+		{Name: "odd", Member: 0}}
+	buf := writeARFileForTest(t, &ar_file)
+	out, err := ReadPlainARFile(bytes.NewReader(buf), int64(len(buf)), "t.a")
+	AssertNoError(t, err)
+	AssertEq(t, 2, len(out.Members))
+	ExpectEq(t, "a.o", out.Members[0].Header.Filename)
+	ExpectEq(t, "odd", string(out.Members[0].Contents))
+	ExpectEq(t, "dir/sixteen_chars.o", out.Members[1].Header.Filename)
+	ExpectEq(t, "even", string(out.Members[1].Contents))
+	member, ok := out.MemberDefining("even")
+	ExpectEq(t, true, ok)
+	ExpectEq(t, 1, member)
+
+	ar_file.Members[0].Header.OwnerID = "1234567"
+	_, err = WriteARFile(&ar_file)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "member a.o: member header field \"1234567\" is longer "+
+		"than 6 bytes", err.Error())
+	ar_file.Members[0].Header.OwnerID = "0"
+	ar_file.Symbols[0].Member = 2
+	_, err = WriteARFile(&ar_file)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "archive symbol even is in member 2, but there are only 2 "+
+		"members", err.Error())
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Fuzz the archive reader, which must return errors for malformed
+// archives instead of panicking. The test archives are the seeds.
+// E.g., go test -run NONE -fuzz FuzzReadPlainARFile ./archive
+
+package archive
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func FuzzReadPlainARFile(f *testing.F) {
+	AddFuzzSeeds(f, "*.a")
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		ar_file, err := ReadPlainARFile(bytes.NewReader(buf),
+			int64(len(buf)), "fuzz.a")
+		if err != nil {
+			return
+		}
+		for _, sym := range ar_file.Symbols {
+			if sym.Member < 0 || sym.Member >= len(ar_file.Members) {
+				t.Errorf("Symbol %s is in member %d, but there are only %d "+
+					"members", sym.Name, sym.Member, len(ar_file.Members))
+			}
+		}
+	})
+}
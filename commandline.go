@@ -3,80 +3,255 @@
 
 // Commandline flags for go-ld driver.
 // This is a very simple linker and does not support many options.
-// TODO(jvoung): replace this. Package "flag" doesn't handle
-// positional arguments before the flags, and we need to know
-// the order in which the flags are given too...
+// The options are parsed like GNU ld parses them: single-letter options
+// may have the value attached ("-lfoo", "-L/path", "-ofile"), and the
+// other options may be given with one or two dashes, with the value
+// either attached with "=" ("--entry=main") or as the next argument
+// ("-entry main"). Input files, "-l" libraries, and position-dependent
+// options are kept in one list, in command-line order.
+// Response files ("@path") are expanded first (see response_files.go).
 
 package main
 
 import (
-	"flag"
 	"fmt"
-)
+	"io"
+	"os"
+	"strconv"
+	"strings"
 
-// Filename for the output.
-var Outfile string
+	"github.com/jvoung/go-ld/driver"
+)
 
-func init() {
-	const (
-		defaultOutfile = "a.out"
-		usage          = "The output filename"
-	)
-	flag.StringVar(&Outfile, "output", defaultOutfile, usage)
-	flag.StringVar(&Outfile, "o", defaultOutfile, usage+" (shorthand)")
+// The result of parsing a command line.
+type CommandLine struct {
+	Outfile           string
+	SearchPaths       []string
+	LibraryFiles      []string
+	Sysroot           string
+	EntryPointFunc    string
+	Emulation         string
+	EhFrameHdr        bool
+	WarnCommon        bool
+	ErrorLimit        int
+	UnresolvedSymbols driver.UnresolvedSymbolsMode
+	Inputs            []driver.InputArg
+	Help              bool
 }
 
-// Search paths for "-l" libraries, specified by -L <path1> -L <path2>.
-// Unfortunately, the go flag library doesn't seem to support the space-less
-// variant of flags "-L<path1>".
-type search_paths []string
-
-func (p *search_paths) String() string {
-	return fmt.Sprint(*p)
+// A command-line option. Single-letter names may have the value
+// attached. A positional option is added to the input list instead
+// of being set. Options with values which may be invalid use parse
+// instead of set.
+type option struct {
+	names      []string
+	has_arg    bool
+	positional bool
+	usage      string
+	set        func(c *CommandLine, value string)
+	parse      func(c *CommandLine, value string) error
 }
-func (p *search_paths) Set(value string) error {
-	*p = append(*p, value)
-	return nil
-}
-
-// The parsed search paths.
-var SearchPaths search_paths
 
-func init() {
-	flag.Var(&SearchPaths, "L", "Add a library (-l) search path")
+var options = []option{
+	{names: []string{"o", "output"}, has_arg: true,
+		usage: "The output filename (default a.out)",
+		set:   func(c *CommandLine, value string) { c.Outfile = value }},
+	{names: []string{"L", "library-path"}, has_arg: true,
+		usage: "Add a library (-l) search path",
+		set: func(c *CommandLine, value string) {
+			c.SearchPaths = append(c.SearchPaths, value)
+		}},
+	{names: []string{"l", "library"}, has_arg: true,
+		usage: "Add a library as input",
+		set: func(c *CommandLine, value string) {
+			c.LibraryFiles = append(c.LibraryFiles, value)
+			c.Inputs = append(c.Inputs, driver.InputArg{Kind: driver.InputLibrary, Value: value})
+		}},
+	{names: []string{"sysroot"}, has_arg: true,
+		usage: "Replace the \"=\" at the start of search paths with this",
+		set:   func(c *CommandLine, value string) { c.Sysroot = value }},
+	{names: []string{"Bstatic", "static", "dn", "non_shared"},
+		positional: true,
+		usage:      "Only look for static (.a) libraries, for the -l after this"},
+	{names: []string{"Bdynamic", "dy", "call_shared"}, positional: true,
+		usage: "Look for shared (.so) libraries before static ones, " +
+			"for the -l after this (the default)"},
+	{names: []string{"start-group", "("}, positional: true,
+		usage: "Start a group of archives, which are searched repeatedly " +
+			"until no new undefined symbols are created"},
+	{names: []string{"end-group", ")"}, positional: true,
+		usage: "End a group of archives"},
+	{names: []string{"whole-archive"}, positional: true,
+		usage: "Link in all the members of the archives after this"},
+	{names: []string{"no-whole-archive"}, positional: true,
+		usage: "Only link in the archive members which are needed " +
+			"(the default)"},
+	{names: []string{"e", "entry"}, has_arg: true,
+		usage: "Set the entry point function name (default _start)",
+		set:   func(c *CommandLine, value string) { c.EntryPointFunc = value }},
+	{names: []string{"m"}, has_arg: true,
+		usage: "Set the emulation (a *_nacl emulation selects the NaCl layout)",
+		set:   func(c *CommandLine, value string) { c.Emulation = value }},
+	{names: []string{"eh-frame-hdr"},
+		usage: "Create an .eh_frame_hdr section",
+		set:   func(c *CommandLine, value string) { c.EhFrameHdr = true }},
+	{names: []string{"warn-common"},
+		usage: "Warn when a common symbol is merged with another common " +
+			"symbol, or overridden by a definition",
+		set: func(c *CommandLine, value string) { c.WarnCommon = true }},
+	{names: []string{"error-limit"}, has_arg: true,
+		usage: "Report at most this many errors (default 20, 0 for no limit)",
+		parse: func(c *CommandLine, value string) error {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				return fmt.Errorf("bad --error-limit value %s", value)
+			}
+			c.ErrorLimit = limit
+			return nil
+		}},
+	{names: []string{"unresolved-symbols"}, has_arg: true,
+		usage: "What to do with undefined symbols: report-all (the " +
+			"default), ignore-all, or ignore-in-object-files",
+		parse: func(c *CommandLine, value string) error {
+			mode, err := driver.ParseUnresolvedSymbolsMode(value)
+			c.UnresolvedSymbols = mode
+			return err
+		}},
+	{names: []string{"help"},
+		usage: "Print the options",
+		set:   func(c *CommandLine, value string) { c.Help = true }},
 }
 
-// Libraries, specified by "-l=libfoo.a" or "-l libfoo.a"... I haven't
-// looked into how to coax the go flag package into accepting "-lfoo"
-// and "-l:libfoo.a".
-//
-// This also doesn't track where static libraries w.r.t. relocatable
-// files. Just assume all libraries show up after relocatable files.
-type lib_names []string
-
-func (l *lib_names) String() string {
-	return fmt.Sprint(*l)
+func findOption(name string) *option {
+	for i := range options {
+		for _, n := range options[i].names {
+			if n == name {
+				return &options[i]
+			}
+		}
+	}
+	return nil
 }
-func (l *lib_names) Set(value string) error {
-	*l = append(*l, value)
+
+func (opt *option) apply(c *CommandLine, name string, value string) error {
+	if opt.positional {
+		c.Inputs = append(c.Inputs, driver.InputArg{Kind: driver.InputOption, Value: opt.names[0]})
+		return nil
+	}
+	if opt.parse != nil {
+		return opt.parse(c, value)
+	}
+	opt.set(c, value)
 	return nil
 }
 
-// The parsed library files paths.
-var LibraryFiles lib_names
+// Parse the arguments (not including the program name).
+func ParseCommandLine(raw_args []string) (CommandLine, error) {
+	c := CommandLine{Outfile: "a.out", EntryPointFunc: "_start",
+		ErrorLimit: 20}
+	args, err := ExpandResponseFiles(raw_args)
+	if err != nil {
+		return c, err
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i].Value
+		if len(arg) < 2 || arg[0] != '-' {
+			c.Inputs = append(c.Inputs, driver.InputArg{Kind: driver.InputFileName, Value: arg})
+			continue
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		single_dash := !strings.HasPrefix(arg, "--")
+		// --name=value (or -name=value). Only for long options: the
+		// value of an attached single-letter option is kept as is, since
+		// -L=dir is a search path in the sysroot.
+		if eq := strings.IndexByte(name, '='); eq > 1 {
+			if opt := findOption(name[:eq]); opt != nil {
+				if !opt.has_arg {
+					return c, args[i].Errorf("option %s does not take a value",
+						arg[:len(arg)-len(name)+eq])
+				}
+				if err := opt.apply(&c, name[:eq], name[eq+1:]); err != nil {
+					return c, args[i].Errorf("%s", err)
+				}
+				continue
+			}
+		}
+		// -name value (or -name for options without a value).
+		if opt := findOption(name); opt != nil {
+			value := ""
+			if opt.has_arg {
+				if i+1 >= len(args) {
+					return c, args[i].Errorf("option %s requires a value", arg)
+				}
+				i++
+				value = args[i].Value
+			}
+			if err := opt.apply(&c, name, value); err != nil {
+				return c, args[i].Errorf("%s", err)
+			}
+			continue
+		}
+		// -Xvalue, for a single-letter option X.
+		if single_dash {
+			if opt := findOption(name[:1]); opt != nil && opt.has_arg {
+				if err := opt.apply(&c, name[:1], name[1:]); err != nil {
+					return c, args[i].Errorf("%s", err)
+				}
+				continue
+			}
+		}
+		return c, args[i].Errorf("unrecognized option %s", arg)
+	}
+	return c, nil
+}
 
-func init() {
-	flag.Var(&LibraryFiles, "l", "Add a library as input")
+// Print the options.
+func PrintUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [options] file...\n", os.Args[0])
+	for i := range options {
+		opt := &options[i]
+		names := make([]string, len(opt.names))
+		for j, n := range opt.names {
+			if len(n) == 1 {
+				names[j] = "-" + n
+			} else {
+				names[j] = "--" + n
+			}
+			if opt.has_arg {
+				names[j] += " <value>"
+			}
+		}
+		fmt.Fprintf(w, "  %s\n\t%s\n", strings.Join(names, ", "), opt.usage)
+	}
 }
 
-// The entry point function.
-var EntryPointFunc string
+// Parse os.Args, exiting with the usage if they can't be parsed
+// (or after printing it, for --help).
+func ParseArgs() CommandLine {
+	c, err := ParseCommandLine(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+		PrintUsage(os.Stderr)
+		os.Exit(2)
+	}
+	if c.Help {
+		PrintUsage(os.Stdout)
+		os.Exit(0)
+	}
+	return c
+}
 
-func init() {
-	const (
-		defaultEntry = "_start"
-		usage        = "Set the entry point function name (default _start)"
-	)
-	flag.StringVar(&EntryPointFunc, "entry", defaultEntry, usage)
-	flag.StringVar(&EntryPointFunc, "e", defaultEntry, usage+" (shorthand)")
+// The link configuration for the command line.
+func (c *CommandLine) Config() driver.Config {
+	return driver.Config{
+		Inputs:            c.Inputs,
+		SearchPaths:       c.SearchPaths,
+		Sysroot:           c.Sysroot,
+		Entry:             c.EntryPointFunc,
+		Output:            c.Outfile,
+		Emulation:         c.Emulation,
+		EhFrameHdr:        c.EhFrameHdr,
+		WarnCommon:        c.WarnCommon,
+		ErrorLimit:        c.ErrorLimit,
+		UnresolvedSymbols: c.UnresolvedSymbols}
 }
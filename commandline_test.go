@@ -0,0 +1,144 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test command-line parsing.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/jvoung/go-ld/driver"
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func parseForTest(t *testing.T, args ...string) CommandLine {
+	c, err := ParseCommandLine(args)
+	if err != nil {
+		t.Fatal("Failed to parse", args, err)
+	}
+	return c
+}
+
+func checkInputs(t *testing.T, expected []driver.InputArg, c CommandLine) {
+	AssertEq(t, len(expected), len(c.Inputs))
+	for i := range expected {
+		ExpectEq(t, expected[i], c.Inputs[i])
+	}
+}
+
+func TestCommandLineDefaults(t *testing.T) {
+	c := parseForTest(t, "a.o")
+	ExpectEq(t, "a.out", c.Outfile)
+	ExpectEq(t, "_start", c.EntryPointFunc)
+	ExpectEq(t, false, c.EhFrameHdr)
+	ExpectEq(t, false, c.WarnCommon)
+	ExpectEq(t, 20, c.ErrorLimit)
+	ExpectEq(t, driver.ReportAllUnresolved, c.UnresolvedSymbols)
+	ExpectEq(t, 0, len(c.SearchPaths))
+	checkInputs(t, []driver.InputArg{{Kind: driver.InputFileName, Value: "a.o"}}, c)
+}
+
+// The option values may be attached, given after "=", or be the
+// next argument, and long options may have one or two dashes.
+func TestCommandLineValueForms(t *testing.T) {
+	for _, args := range [][]string{
+		{"-o", "out", "-e", "main", "-m", "elf_nacl"},
+		{"-oout", "-emain", "-melf_nacl"},
+		{"--output=out", "--entry=main", "-melf_nacl"},
+		{"-output", "out", "-entry", "main", "-m", "elf_nacl"},
+		{"--output", "out", "--entry", "main", "-melf_nacl"}} {
+		c := parseForTest(t, args...)
+		ExpectEqM(t, "out", c.Outfile, args[0])
+		ExpectEqM(t, "main", c.EntryPointFunc, args[0])
+		ExpectEqM(t, "elf_nacl", c.Emulation, args[0])
+	}
+	c := parseForTest(t, "--eh-frame-hdr")
+	ExpectEq(t, true, c.EhFrameHdr)
+	c = parseForTest(t, "-eh-frame-hdr")
+	ExpectEq(t, true, c.EhFrameHdr)
+	c = parseForTest(t, "--warn-common")
+	ExpectEq(t, true, c.WarnCommon)
+	c = parseForTest(t, "--error-limit=0", "--unresolved-symbols",
+		"ignore-in-object-files")
+	ExpectEq(t, 0, c.ErrorLimit)
+	ExpectEq(t, driver.IgnoreUnresolvedInObjectFiles, c.UnresolvedSymbols)
+}
+
+// Objects and libraries stay in command-line order, but the search
+// paths apply to everything.
+func TestCommandLineOrder(t *testing.T) {
+	c := parseForTest(t, "crtbegin.o", "-lfoo", "-L/a", "main.o",
+		"-l:libbar.a", "--library=baz", "-L", "/b", "-l", "qux",
+		"--library-path=/c", "crtend.o")
+	checkInputs(t, []driver.InputArg{
+		{Kind: driver.InputFileName, Value: "crtbegin.o"},
+		{Kind: driver.InputLibrary, Value: "foo"},
+		{Kind: driver.InputFileName, Value: "main.o"},
+		{Kind: driver.InputLibrary, Value: ":libbar.a"},
+		{Kind: driver.InputLibrary, Value: "baz"},
+		{Kind: driver.InputLibrary, Value: "qux"},
+		{Kind: driver.InputFileName, Value: "crtend.o"}}, c)
+	expected_paths := []string{"/a", "/b", "/c"}
+	AssertEq(t, len(expected_paths), len(c.SearchPaths))
+	for i := range expected_paths {
+		ExpectEq(t, expected_paths[i], c.SearchPaths[i])
+	}
+	AssertEq(t, 4, len(c.LibraryFiles))
+	ExpectEq(t, ":libbar.a", c.LibraryFiles[1])
+}
+
+// An attached single-letter value keeps its "=", e.g., for a search path
+// in the sysroot, but --name=value is split.
+func TestCommandLineSysrootSearchPath(t *testing.T) {
+	c := parseForTest(t, "-L=/usr/lib", "--library-path==/lib",
+		"-l=foo", "-o=out", "--sysroot=/sysroot")
+	AssertEq(t, 2, len(c.SearchPaths))
+	ExpectEq(t, "=/usr/lib", c.SearchPaths[0])
+	ExpectEq(t, "=/lib", c.SearchPaths[1])
+	checkInputs(t, []driver.InputArg{
+		{Kind: driver.InputLibrary, Value: "=foo"}}, c)
+	ExpectEq(t, "=out", c.Outfile)
+	ExpectEq(t, "/sysroot", c.Sysroot)
+	sp := driver.SysrootSearchPaths(c.SearchPaths, c.Sysroot)
+	ExpectEq(t, "/sysroot/usr/lib", sp[0])
+	ExpectEq(t, "/sysroot/lib", sp[1])
+}
+
+func TestCommandLineErrors(t *testing.T) {
+	errors := map[string][]string{
+		"unrecognized option --bogus":                 {"--bogus"},
+		"unrecognized option -x":                      {"a.o", "-x"},
+		"option -o requires a value":                  {"a.o", "-o"},
+		"option --eh-frame-hdr does not take a value": {"--eh-frame-hdr=yes"},
+		"bad --error-limit value -1":                  {"--error-limit=-1"},
+		"bad --error-limit value ten":                 {"--error-limit", "ten"},
+		"bad --unresolved-symbols value some (expected report-all, " +
+			"ignore-all, or ignore-in-object-files)": {
+			"--unresolved-symbols=some"},
+	}
+	for expected, args := range errors {
+		_, err := ParseCommandLine(args)
+		if err == nil {
+			t.Error("Expected an error for", args)
+			continue
+		}
+		ExpectEq(t, expected, err.Error())
+	}
+}
+
+// -Bstatic and -Bdynamic (and their other names) stay in the input
+// list, to apply to the -l options after them.
+func TestCommandLinePositionalOptions(t *testing.T) {
+	c := parseForTest(t, "-lfoo", "-Bstatic", "-lbar", "-Bdynamic", "-lbaz",
+		"-static", "--sysroot=/sys", "-lqux")
+	checkInputs(t, []driver.InputArg{
+		{Kind: driver.InputLibrary, Value: "foo"},
+		{Kind: driver.InputOption, Value: "Bstatic"},
+		{Kind: driver.InputLibrary, Value: "bar"},
+		{Kind: driver.InputOption, Value: "Bdynamic"},
+		{Kind: driver.InputLibrary, Value: "baz"},
+		{Kind: driver.InputOption, Value: "Bstatic"},
+		{Kind: driver.InputLibrary, Value: "qux"}}, c)
+	ExpectEq(t, "/sys", c.Sysroot)
+}
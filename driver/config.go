@@ -0,0 +1,105 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// What to link (the inputs, found through the search paths), and how.
+
+package driver
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+// The kinds of entries in the ordered input list.
+type InputKind int
+
+const (
+	InputFileName InputKind = iota // An object or archive file.
+	InputLibrary                   // A "-l" library, found through SearchPaths.
+	InputOption                    // A position-dependent option.
+)
+
+func (k InputKind) String() string {
+	switch k {
+	case InputFileName:
+		return "file"
+	case InputLibrary:
+		return "library"
+	case InputOption:
+		return "option"
+	default:
+		return "unknown input kind"
+	}
+}
+
+// An entry of the ordered input list. Value is the file name, the
+// library name (foo for -lfoo), or the option name (without dashes,
+// and the first of its names if it has several).
+type InputArg struct {
+	Kind  InputKind
+	Value string
+}
+
+// The configuration of a link. The zero values of the optional fields
+// are the defaults.
+type Config struct {
+	// The input files, libraries, and position-dependent options,
+	// in command-line order.
+	Inputs []InputArg
+	// Search paths for the libraries. As with ld, these apply to all
+	// the libraries.
+	SearchPaths []string
+	// The sysroot, which replaces the "=" at the start of a search path.
+	Sysroot string
+	// The entry point symbol (default _start).
+	Entry string
+	// The file to write the output to. If empty, the output is only
+	// returned in the Result.
+	Output string
+	// The emulation, e.g., "elf_nacl". Only used to choose between the
+	// standard and NaCl layouts.
+	Emulation string
+	// Whether to create an .eh_frame_hdr section and PT_GNU_EH_FRAME
+	// segment.
+	EhFrameHdr bool
+	// Whether to warn when COMMON symbols are merged or overridden.
+	WarnCommon bool
+	// The most undefined references to report (0 for no limit, while
+	// the command line's default is 20).
+	ErrorLimit int
+	// What to do with undefined references.
+	UnresolvedSymbols UnresolvedSymbolsMode
+	// Where to describe the steps of the link (nil for nowhere).
+	Log io.Writer
+}
+
+// The result of a successful link.
+type Result struct {
+	// The output file.
+	File elffile.ElfFile
+	// The names of the objects which were linked in (archive members
+	// are archive(member)), in layout order.
+	Objects []string
+	// Problems which didn't stop the link, e.g., from WarnCommon.
+	Warnings []string
+}
+
+// The problems which stopped a link, e.g., each of the input files
+// which couldn't be read, or each undefined reference.
+type LinkError struct {
+	Errors []error
+}
+
+func (e *LinkError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *LinkError) Unwrap() []error {
+	return e.Errors
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Link the inputs: find and read them, pick the archive members which
+// are needed, resolve the symbols, lay out the output, and relocate it.
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jvoung/go-ld/elffile"
+	"github.com/jvoung/go-ld/layout"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+// The objects (and their SymbolTables) of one input, which is either
+// a .o file, or a .a file with one object for each member.
+type read_symbols_result struct {
+	index int
+	input resolver.InputFile
+	err   error
+}
+
+func read_symbols_task(index int, fname string, ftyp resolver.FileType,
+	fhandles map[string]*os.File,
+	done_ch chan read_symbols_result) {
+	input, err := resolver.ReadInputFile(fhandles[fname], fname, ftyp)
+	done_ch <- read_symbols_result{index, input, err}
+}
+
+// Link the inputs of the config, and write the output (if config has an
+// Output). Problems with the inputs are *LinkErrors (or *InputErrors,
+// for an input which can't be read).
+func Link(ctx context.Context, config Config) (*Result, error) {
+	log := func(args ...interface{}) {
+		if config.Log != nil {
+			fmt.Fprintln(config.Log, args...)
+		}
+	}
+	entry_sym := config.Entry
+	if entry_sym == "" {
+		entry_sym = "_start"
+	}
+	log("Writing to:", config.Output)
+	log("With entry point func:", entry_sym)
+	log("Search Paths to:", config.SearchPaths)
+	log("Inputs:", config.Inputs)
+
+	// Go through search-paths to figure out the actual filenames of libs,
+	// keeping them in order with the other inputs. Other non-library
+	// inputs aren't found in the library paths.
+	full_paths, groups, err := ResolveInputs(config.Inputs,
+		SysrootSearchPaths(config.SearchPaths, config.Sysroot))
+	if err != nil {
+		return nil, err
+	}
+	log("Full paths of inputs and libs:", full_paths)
+
+	// Open the files.
+	fhandles := make(map[string]*os.File, len(full_paths))
+	for _, input_path := range full_paths {
+		fname := input_path.Name
+		if _, ok := fhandles[fname]; ok {
+			continue
+		}
+		f, err := os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fhandles[fname] = f
+	}
+
+	// Validate that the inputs are really ELF or .a files
+	// full of ELF.
+	file_map, err := resolver.ValidateFiles(fhandles)
+	if err != nil {
+		return nil, err
+	}
+	log("File types:", file_map)
+
+	// Read the inputs in parallel, keeping them in command-line order.
+	input_files := make([]resolver.InputFile, len(full_paths))
+	read_symbols := make(chan read_symbols_result, len(full_paths))
+	for i, input_path := range full_paths {
+		go read_symbols_task(i, input_path.Name, file_map[input_path.Name],
+			fhandles, read_symbols)
+	}
+	read_errors := make([]error, len(full_paths))
+	for i := 0; i < len(full_paths); i++ {
+		select {
+		case result := <-read_symbols:
+			input_files[result.index] = result.input
+			input_files[result.index].WholeArchive =
+				full_paths[result.index].WholeArchive
+			read_errors[result.index] = result.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	link_err := &LinkError{}
+	for _, err := range read_errors {
+		if err != nil {
+			link_err.Errors = append(link_err.Errors, err)
+		}
+	}
+	if len(link_err.Errors) != 0 {
+		return nil, link_err
+	}
+
+	// Pull in the archive members which are needed.
+	selection, err := resolver.SelectArchiveMembers(input_files, groups)
+	if err != nil {
+		return nil, err
+	}
+	for _, rescan := range selection.Rescans {
+		log(rescan.String())
+	}
+	for _, duplicate := range selection.Duplicates {
+		link_err.Errors = append(link_err.Errors,
+			errors.New(duplicate.String()))
+	}
+	if len(link_err.Errors) != 0 {
+		return nil, link_err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	objects := selection.Objects
+	result := &Result{Warnings: selection.Warnings}
+
+	// Map the objects (index) -> symbol tables. The index is also
+	// the layout order.
+	f_symbols := make([]elffile.SymbolTable, len(objects))
+	// The definitions of each object, found as it was read.
+	f_defs := make([]resolver.FileDefinitions, len(objects))
+
+	// Remember the elf files too (section headers, etc.)
+	elf_files := make([]elffile.ElfFile, len(objects))
+	for i := range objects {
+		log("Linking in:", objects[i].Name)
+		f_symbols[i] = objects[i].Syms
+		f_defs[i] = objects[i].Defs
+		elf_files[i] = objects[i].File
+		result.Objects = append(result.Objects, objects[i].Name)
+	}
+	log("file symbols:", f_symbols)
+
+	// Resolve symbols to the files that define them, merging the
+	// definitions into one table in link order.
+	resolved_sym_info := resolver.ResolveFileDefinitions(f_symbols, f_defs)
+	log("resolved symbol info:", resolved_sym_info)
+	if config.WarnCommon {
+		result.Warnings = append(result.Warnings,
+			resolver.CommonSymbolWarnings(f_symbols, resolved_sym_info,
+				result.Objects)...)
+	}
+
+	// Lay out the files, adjusting the symbol table values
+	// from offsets to absolute addresses.
+	out, err := layout.DoLayout(f_symbols, elf_files, resolved_sym_info,
+		layout.LayoutOptions{
+			Mode:        layout.LayoutModeForEmulation(config.Emulation),
+			EhFrameHdr:  config.EhFrameHdr,
+			ObjectNames: result.Objects})
+	if err != nil {
+		return nil, err
+	}
+	log("layout:\n" + out.String())
+
+	// Fix up the relocations based on the layout.
+	reloc_ctx := layout.RelocContext{Files: elf_files, Syms: f_symbols,
+		LinkInfo: resolved_sym_info, Sections: out.Sections,
+		Out:        out.File.Body,
+		ByteOrder:  elffile.ToByteOrder(out.File.Header.Data),
+		GOT:        out.GOT,
+		LinkerSyms: out.LinkerSyms}
+	if config.UnresolvedSymbols.ReportsObjectFiles() {
+		undefined := reloc_ctx.UndefinedReferences(result.Objects)
+		for _, msg := range UndefinedReferenceErrors(undefined,
+			config.ErrorLimit) {
+			link_err.Errors = append(link_err.Errors, errors.New(msg))
+		}
+		if len(link_err.Errors) != 0 {
+			return nil, link_err
+		}
+	}
+	link_err.Errors = append(link_err.Errors,
+		reloc_ctx.ApplyRelocations(result.Objects)...)
+	if len(link_err.Errors) != 0 {
+		return nil, link_err
+	}
+	reloc_ctx.FillGOT()
+
+	entry, ok := layout.FindGlobalSymbol(entry_sym, f_symbols,
+		resolved_sym_info)
+	if !ok {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("cannot find entry symbol %s", entry_sym))
+	}
+	out.File.Header.Entry = entry
+	result.File = out.File
+
+	// Write out the file.
+	if config.Output != "" {
+		if err := elffile.WriteElfFileFname(&result.File,
+			config.Output); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test linking through the library API.
+
+package driver
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+	. "github.com/jvoung/go-ld/internal/testutil/elftest"
+)
+
+func TestLink(t *testing.T) {
+	dir := TestX8632BaseDir()
+	main_obj := path.Join(dir, "test_weak_main.o")
+	strong := path.Join(dir, "test_weak_strong.o")
+	out_name := path.Join(t.TempDir(), "out")
+	result, err := Link(context.Background(), Config{
+		Inputs: []InputArg{
+			{Kind: InputFileName, Value: main_obj},
+			{Kind: InputFileName, Value: strong},
+			// Only referenced weakly, so nothing is pulled in.
+			{Kind: InputLibrary, Value: "weak"}},
+		SearchPaths: []string{dir},
+		Entry:       "UseWeak",
+		Output:      out_name})
+	AssertNoError(t, err)
+	AssertEq(t, 2, len(result.Objects))
+	ExpectEq(t, main_obj, result.Objects[0])
+	ExpectEq(t, strong, result.Objects[1])
+	ExpectEq(t, 0, len(result.Warnings))
+	ExpectEq(t, elf.ET_EXEC, result.File.Header.Type)
+	ExpectEq(t, elf.EM_386, result.File.Header.Machine)
+	ExpectEq(t, false, result.File.Header.Entry == 0)
+
+	// The output is written too.
+	out := ReadElfFileFname(out_name)
+	ExpectEq(t, result.File.Header, out.Header)
+}
+
+func TestLinkErrors(t *testing.T) {
+	dir := TestX8632BaseDir()
+	ctx := context.Background()
+	_, err := Link(ctx, Config{})
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "no input files", err.Error())
+
+	// An archive which doesn't contribute anything.
+	_, err = Link(ctx, Config{
+		Inputs:      []InputArg{{Kind: InputLibrary, Value: "weak"}},
+		SearchPaths: []string{dir}})
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "no input files", err.Error())
+
+	// Each undefined reference is an error, unless they are ignored.
+	undefined := Config{Inputs: []InputArg{
+		{Kind: InputFileName, Value: path.Join(dir, "test_undefined.o")}},
+		Entry: "undefined_main"}
+	_, err = Link(ctx, undefined)
+	var link_err *LinkError
+	AssertEq(t, true, errors.As(err, &link_err))
+	AssertEq(t, 2, len(link_err.Errors))
+	ExpectEqM(t, true, strings.HasSuffix(link_err.Errors[0].Error(),
+		"undefined reference to 'missing_func'"), link_err.Errors[0].Error())
+	undefined.UnresolvedSymbols = IgnoreAllUnresolved
+	_, err = Link(ctx, undefined)
+	AssertNoError(t, err)
+
+	// The entry symbol is only a warning.
+	undefined.Entry = "not_a_symbol"
+	result, err := Link(ctx, undefined)
+	AssertNoError(t, err)
+	AssertEq(t, 1, len(result.Warnings))
+	ExpectEq(t, "cannot find entry symbol not_a_symbol", result.Warnings[0])
+
+	// The same object twice is read twice, so its definitions are
+	// duplicates.
+	common_a := path.Join(dir, "test_common_a.o")
+	_, err = Link(ctx, Config{Inputs: []InputArg{
+		{Kind: InputFileName, Value: common_a},
+		{Kind: InputFileName, Value: common_a}}})
+	AssertEq(t, true, errors.As(err, &link_err))
+	AssertEq(t, 1, len(link_err.Errors))
+	ExpectEq(t, "multiple definition of UseCommon: first defined in "+
+		common_a+", and again in "+common_a, link_err.Errors[0].Error())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = Link(cancelled, undefined)
+	ExpectEq(t, context.Canceled, err)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Determine full file paths based on search paths.
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jvoung/go-ld/resolver"
+)
+
+func fileExists(filename string) bool {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
+
+// Search paths starting with "=" are relative to the sysroot.
+func SysrootSearchPaths(search_paths []string, sysroot string) []string {
+	out := make([]string, len(search_paths))
+	for i, sp := range search_paths {
+		if strings.HasPrefix(sp, "=") {
+			sp = sysroot + sp[1:]
+		}
+		out[i] = sp
+	}
+	return out
+}
+
+// Find the file for "-l name" like ld does. If name starts with ":",
+// it's the exact filename. Otherwise, each search path is tried for
+// libname.so and then libname.a, or just libname.a if static.
+func FindLibrary(name string, search_paths []string, static bool) (string, bool) {
+	candidates := []string{"lib" + name + ".so", "lib" + name + ".a"}
+	if static {
+		candidates = candidates[1:]
+	}
+	if strings.HasPrefix(name, ":") {
+		candidates = []string{name[1:]}
+	}
+	for _, sp := range search_paths {
+		for _, c := range candidates {
+			joined := path.Join(sp, c)
+			if fileExists(joined) {
+				return joined, true
+			}
+		}
+	}
+	return "", false
+}
+
+// The path of an input file, and whether it was given with --whole-archive.
+type InputPath struct {
+	Name         string
+	WholeArchive bool
+}
+
+// Get the paths of the input files (finding the -l libraries, which may
+// be affected by -Bstatic/-Bdynamic), and the groups of inputs from
+// --start-group/--end-group.
+func ResolveInputs(inputs []InputArg, search_paths []string) ([]InputPath,
+	[]resolver.InputGroup, error) {
+	paths := make([]InputPath, 0, len(inputs))
+	groups := []resolver.InputGroup{}
+	static := false
+	whole_archive := false
+	in_group := false
+	for _, input := range inputs {
+		switch input.Kind {
+		case InputFileName:
+			paths = append(paths, InputPath{input.Value, whole_archive})
+		case InputLibrary:
+			lib, ok := FindLibrary(input.Value, search_paths, static)
+			if !ok {
+				return nil, nil, fmt.Errorf("cannot find -l%s", input.Value)
+			}
+			paths = append(paths, InputPath{lib, whole_archive})
+		case InputOption:
+			switch input.Value {
+			case "Bstatic":
+				static = true
+			case "Bdynamic":
+				static = false
+			case "whole-archive":
+				whole_archive = true
+			case "no-whole-archive":
+				whole_archive = false
+			case "start-group":
+				if in_group {
+					return nil, nil, errors.New("nested --start-group")
+				}
+				in_group = true
+				groups = append(groups, resolver.InputGroup{Start: len(paths), End: len(paths)})
+			case "end-group":
+				if !in_group {
+					return nil, nil, errors.New("--end-group without --start-group")
+				}
+				in_group = false
+				groups[len(groups)-1].End = len(paths)
+			}
+		}
+	}
+	if in_group {
+		return nil, nil, errors.New("--start-group without --end-group")
+	}
+	return paths, groups, nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Test for the simple search_paths utils.
+
+package driver
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+func TestNoPathsNoDirs(t *testing.T) {
+	_, ok := FindLibrary("gcc", []string{}, false)
+	ExpectEq(t, false, ok)
+}
+
+func CheckMultiSearchPaths(t *testing.T, sp []string) {
+	for _, name := range []string{"crt_platform", "gcc", "pnacl_irt_shim"} {
+		lib, ok := FindLibrary(name, sp, true)
+		ExpectEq(t, true, ok)
+		ExpectEq(t, path.Join(sp[0], "lib"+name+".a"), lib)
+	}
+}
+
+func TestOneSearchPath(t *testing.T) {
+	sp := []string{TestX8632BaseDir()}
+	CheckMultiSearchPaths(t, sp)
+}
+
+func TestTwoSearchPathsA(t *testing.T) {
+	sp := []string{TestX8632BaseDir(), TestX8664BaseDir()}
+	CheckMultiSearchPaths(t, sp)
+}
+
+func TestTwoSearchPathsB(t *testing.T) {
+	sp := []string{TestX8664BaseDir(), TestX8632BaseDir()}
+	CheckMultiSearchPaths(t, sp)
+}
+
+func TestThreeSearchPaths(t *testing.T) {
+	sp := []string{TestARMBaseDir(), TestX8632BaseDir(),
+		TestX8664BaseDir()}
+	CheckMultiSearchPaths(t, sp)
+}
+
+func TestNoShadowPaths(t *testing.T) {
+	for _, sp := range [][]string{{TestARMBaseDir(), TestLibDir()},
+		{TestLibDir(), TestARMBaseDir()}} {
+		lib, ok := FindLibrary("crt_platform", sp, true)
+		ExpectEq(t, true, ok)
+		ExpectEq(t, path.Join(TestARMBaseDir(), "libcrt_platform.a"), lib)
+		lib, ok = FindLibrary("foo_in_libdir", sp, true)
+		ExpectEq(t, true, ok)
+		ExpectEq(t, path.Join(TestLibDir(), "libfoo_in_libdir.a"), lib)
+	}
+}
+
+func TestFindLibrary(t *testing.T) {
+	sp := []string{TestARMBaseDir(), TestLibDir()}
+	lib, ok := FindLibrary("foo_in_libdir", sp, false)
+	ExpectEq(t, true, ok)
+	ExpectEq(t, path.Join(sp[1], "libfoo_in_libdir.a"), lib)
+	lib, ok = FindLibrary("crt_platform", sp, true)
+	ExpectEq(t, true, ok)
+	ExpectEq(t, path.Join(sp[0], "libcrt_platform.a"), lib)
+	// -l:name is the exact filename.
+	lib, ok = FindLibrary(":libfoo_in_libdir.a", sp, false)
+	ExpectEq(t, true, ok)
+	ExpectEq(t, path.Join(sp[1], "libfoo_in_libdir.a"), lib)
+	_, ok = FindLibrary(":foo_in_libdir", sp, false)
+	ExpectEq(t, false, ok)
+	_, ok = FindLibrary("nonexistent", sp, false)
+	ExpectEq(t, false, ok)
+}
+
+// In each directory, libfoo.so is preferred over libfoo.a (unless
+// static), but an earlier directory with libfoo.a wins over a later
+// directory with libfoo.so.
+func TestFindLibrarySharedFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-ld-search-paths")
+	if err != nil {
+		t.Fatal("Failed to create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	sp := []string{path.Join(dir, "a"), path.Join(dir, "b")}
+	for _, fname := range []string{"a/libboth.so", "a/libboth.a",
+		"a/libstatic.a", "b/libstatic.so"} {
+		os.MkdirAll(path.Dir(path.Join(dir, fname)), 0755)
+		if err := ioutil.WriteFile(path.Join(dir, fname), nil, 0644); err != nil {
+			t.Fatal("Failed to create", fname, err)
+		}
+	}
+	lib, _ := FindLibrary("both", sp, false)
+	ExpectEq(t, path.Join(sp[0], "libboth.so"), lib)
+	lib, _ = FindLibrary("both", sp, true)
+	ExpectEq(t, path.Join(sp[0], "libboth.a"), lib)
+	lib, _ = FindLibrary("static", sp, false)
+	ExpectEq(t, path.Join(sp[0], "libstatic.a"), lib)
+}
+
+func TestSysrootSearchPaths(t *testing.T) {
+	sp := SysrootSearchPaths([]string{"=/usr/lib", "/lib", "lib=x"},
+		"/sysroot")
+	ExpectEq(t, "/sysroot/usr/lib", sp[0])
+	ExpectEq(t, "/lib", sp[1])
+	ExpectEq(t, "lib=x", sp[2])
+	ExpectEq(t, "/usr/lib", SysrootSearchPaths([]string{"=/usr/lib"}, "")[0])
+
+	// Find libfoo_in_libdir.a through a sysroot.
+	sp = SysrootSearchPaths([]string{"=/" + path.Base(TestLibDir())},
+		path.Dir(TestLibDir()))
+	lib, ok := FindLibrary("foo_in_libdir", sp, false)
+	ExpectEq(t, true, ok)
+	ExpectEq(t, path.Join(TestLibDir(), "libfoo_in_libdir.a"), lib)
+}
+
+// The inputs for args, which are parsed like the command line (but only
+// files, "-l" libraries, and positional "--" options).
+func inputsForTest(args ...string) []InputArg {
+	inputs := make([]InputArg, len(args))
+	for i, arg := range args {
+		switch {
+		case arg == "-(":
+			inputs[i] = InputArg{Kind: InputOption, Value: "start-group"}
+		case arg == "-)":
+			inputs[i] = InputArg{Kind: InputOption, Value: "end-group"}
+		case strings.HasPrefix(arg, "--"):
+			inputs[i] = InputArg{Kind: InputOption, Value: arg[2:]}
+		case strings.HasPrefix(arg, "-l"):
+			inputs[i] = InputArg{Kind: InputLibrary, Value: arg[2:]}
+		default:
+			inputs[i] = InputArg{Kind: InputFileName, Value: arg}
+		}
+	}
+	return inputs
+}
+
+func TestResolveInputGroups(t *testing.T) {
+	sp := []string{TestX8632BaseDir()}
+	inputs := inputsForTest("a.o", "--start-group", "-lgcc",
+		"-lcrt_platform", "--end-group", "b.o", "-(", "-)")
+	paths, groups, err := ResolveInputs(inputs, sp)
+	AssertNoError(t, err)
+	expected := []string{"a.o", path.Join(sp[0], "libgcc.a"),
+		path.Join(sp[0], "libcrt_platform.a"), "b.o"}
+	AssertEq(t, len(expected), len(paths))
+	for i := range expected {
+		ExpectEq(t, expected[i], paths[i].Name)
+	}
+	AssertEq(t, 2, len(groups))
+	ExpectEq(t, resolver.InputGroup{Start: 1, End: 3}, groups[0])
+	ExpectEq(t, resolver.InputGroup{Start: 4, End: 4}, groups[1])
+
+	errors := map[string][]string{
+		"nested --start-group":              {"--start-group", "-("},
+		"--end-group without --start-group": {"--end-group"},
+		"--start-group without --end-group": {"--start-group", "a.o"},
+		"cannot find -lnot_a_library":       {"-lnot_a_library"}}
+	for expected, args := range errors {
+		_, _, err := ResolveInputs(inputsForTest(args...), sp)
+		if err == nil {
+			t.Error("Expected an error for", args)
+			continue
+		}
+		ExpectEq(t, expected, err.Error())
+	}
+}
+
+func TestResolveInputsWholeArchive(t *testing.T) {
+	inputs := inputsForTest("a.o", "--whole-archive", "b.a", "c.a",
+		"--no-whole-archive", "d.a")
+	paths, _, err := ResolveInputs(inputs, nil)
+	AssertNoError(t, err)
+	expected := []InputPath{{"a.o", false}, {"b.a", true}, {"c.a", true},
+		{"d.a", false}}
+	AssertEq(t, len(expected), len(paths))
+	for i := range expected {
+		ExpectEq(t, expected[i], paths[i])
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Diagnostics for undefined symbols (see layout.UndefinedReference),
+// and what to do about them.
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/jvoung/go-ld/layout"
+)
+
+// What to do with undefined references (--unresolved-symbols).
+type UnresolvedSymbolsMode int
+
+const (
+	// Report them as errors (the default).
+	ReportAllUnresolved UnresolvedSymbolsMode = iota
+	// Resolve them to 0.
+	IgnoreAllUnresolved
+	// Don't report the ones from object files. Only shared libraries'
+	// would be reported, but shared libraries aren't supported, so this
+	// is the same as IgnoreAllUnresolved.
+	IgnoreUnresolvedInObjectFiles
+)
+
+var unresolvedSymbolsModes = map[string]UnresolvedSymbolsMode{
+	"report-all":             ReportAllUnresolved,
+	"ignore-all":             IgnoreAllUnresolved,
+	"ignore-in-object-files": IgnoreUnresolvedInObjectFiles,
+}
+
+func ParseUnresolvedSymbolsMode(value string) (UnresolvedSymbolsMode, error) {
+	mode, ok := unresolvedSymbolsModes[value]
+	if !ok {
+		return ReportAllUnresolved, fmt.Errorf(
+			"bad --unresolved-symbols value %s (expected report-all, "+
+				"ignore-all, or ignore-in-object-files)", value)
+	}
+	return mode, nil
+}
+
+// Whether undefined references from object files are errors.
+func (m UnresolvedSymbolsMode) ReportsObjectFiles() bool {
+	return m == ReportAllUnresolved
+}
+
+// The diagnostics for the undefined references, showing at most
+// error_limit of them (0 for no limit).
+func UndefinedReferenceErrors(refs []layout.UndefinedReference,
+	error_limit int) []string {
+	errors := []string{}
+	for _, ref := range refs {
+		if error_limit > 0 && len(errors) == error_limit {
+			errors = append(errors, fmt.Sprintf("too many errors emitted, "+
+				"stopping now (use --error-limit=0 to see all %d errors)",
+				len(refs)))
+			break
+		}
+		errors = append(errors, ref.String())
+	}
+	return errors
+}
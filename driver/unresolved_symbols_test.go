@@ -0,0 +1,53 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test the undefined symbol diagnostics.
+
+package driver
+
+import (
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+	"github.com/jvoung/go-ld/layout"
+)
+
+func TestUndefinedReferenceErrors(t *testing.T) {
+	refs := []layout.UndefinedReference{
+		{Symbol: "a", File: "x.o", Section: ".text", Offset: 0x10,
+			Function: "f"},
+		{Symbol: "b", File: "x.o", Section: ".data", Offset: 0x8,
+			Function: ""},
+		{Symbol: "c", File: "y.o", Section: ".text", Offset: 0x0,
+			Function: "g"}}
+	all := []string{
+		"x.o:(.text+0x10): in function 'f': undefined reference to 'a'",
+		"x.o:(.data+0x8): undefined reference to 'b'",
+		"y.o:(.text+0x0): in function 'g': undefined reference to 'c'"}
+	for _, limit := range []int{0, 3, 4} {
+		errors := UndefinedReferenceErrors(refs, limit)
+		AssertEq(t, len(all), len(errors))
+		for i := range all {
+			ExpectEq(t, all[i], errors[i])
+		}
+	}
+	errors := UndefinedReferenceErrors(refs, 2)
+	AssertEq(t, 3, len(errors))
+	ExpectEq(t, all[1], errors[1])
+	ExpectEq(t, "too many errors emitted, stopping now "+
+		"(use --error-limit=0 to see all 3 errors)", errors[2])
+}
+
+func TestParseUnresolvedSymbolsMode(t *testing.T) {
+	for value, expected := range map[string]UnresolvedSymbolsMode{
+		"report-all":             ReportAllUnresolved,
+		"ignore-all":             IgnoreAllUnresolved,
+		"ignore-in-object-files": IgnoreUnresolvedInObjectFiles} {
+		mode, err := ParseUnresolvedSymbolsMode(value)
+		AssertEqM(t, nil, err, value)
+		ExpectEq(t, expected, mode)
+		ExpectEqM(t, value == "report-all", mode.ReportsObjectFiles(), value)
+	}
+	_, err := ParseUnresolvedSymbolsMode("ignore-some")
+	ExpectEq(t, false, err == nil)
+}
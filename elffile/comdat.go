@@ -0,0 +1,43 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Read the COMDAT section groups of an ELF file.
+
+package elffile
+
+import (
+	"debug/elf"
+)
+
+const GRP_COMDAT = 0x1
+
+// A COMDAT section group: the signature, and the member sections.
+type ComdatGroup struct {
+	Signature string
+	Members   []int
+}
+
+// Get the COMDAT groups of a file.
+func ComdatGroups(f *ElfFile, syms SymbolTable) []ComdatGroup {
+	groups := []ComdatGroup{}
+	byte_order := ToByteOrder(f.Header.Data)
+	for j := range f.Shdrs {
+		shdr := &f.Shdrs[j]
+		if shdr.Sh_type != elf.SHT_GROUP || int(shdr.Sh_info) >= len(syms) {
+			continue
+		}
+		words := f.Body[shdr.Sh_offset : shdr.Sh_offset+shdr.Sh_size]
+		if len(words) < 4 || byte_order.Uint32(words)&GRP_COMDAT == 0 {
+			continue
+		}
+		group := ComdatGroup{Signature: syms[shdr.Sh_info].St_name}
+		for off := 4; off+4 <= len(words); off += 4 {
+			member := int(byte_order.Uint32(words[off:]))
+			if member < len(f.Shdrs) {
+				group.Members = append(group.Members, member)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
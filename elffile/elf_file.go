@@ -0,0 +1,714 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Representation of ELF file (separate from go's debug/elf,
+// modulo some constants and printing functions).
+
+package elffile
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The first bytes of an ELF file.
+const ELF_MAGIC = "\x7fELF"
+
+// Phnum value meaning the number of program headers is in the Sh_info
+// of section header 0 (debug/elf doesn't have this one).
+const PN_XNUM = 0xffff
+
+// Rounded-up ELF header (elf class 32 and 64 layout is the same order)
+type ElfFileHeader struct {
+	// Offset 0-3 is the ELF magic number.
+	Class      elf.Class   // Offset 4
+	Data       elf.Data    // Offset 5 (endianness, etc.)
+	EI_Version elf.Version // Offset 6
+	OSABI      elf.OSABI   // Offset 7
+	ABIVersion uint8       // Offset 8
+	// Padding Offset 9-15
+	Type           elf.Type    // Offset 0x10
+	Machine        elf.Machine // Offset 0x12
+	E_Version      uint32      // Offset 0x14
+	Entry          uint64      // Offset 0x18 (could have been uint32)
+	Phoff          uint64      // (could have been uint32)
+	Shoff          uint64      // (could have been uint32)
+	Flags          uint32
+	FileHeaderSize uint16
+	Phentsize      uint16
+	// With extended numbering, these are PN_XNUM, 0 and SHN_XINDEX
+	// and the real values are in section header 0 (see headerCounts).
+	Phnum     uint16
+	Shentsize uint16
+	Shnum     uint16
+	Shstrndx  uint16
+}
+
+// PHDRs (elf class 32 and 64 have slightly different layout...)
+type ProgramHeader struct {
+	P_type   elf.ProgType
+	P_flags  elf.ProgFlag // flags after memsz for elf-class 32
+	P_offset uint64
+	P_vaddr  uint64
+	P_paddr  uint64
+	P_filesz uint64
+	P_memsz  uint64
+	P_align  uint64
+}
+
+// Rounded-up Section Headers (elf class 32 and 64 layout is the same order)
+type SectionHeader struct {
+	Sh_name_index uint32
+	Sh_name       string
+	Sh_type       elf.SectionType
+	Sh_flags      elf.SectionFlag // 32 or 64
+	Sh_addr       uint64          // or 32
+	Sh_offset     uint64          // or 32
+	Sh_size       uint64          // or 32
+	Sh_link       uint32
+	Sh_info       uint32
+	Sh_addralign  uint64 // or 32
+	Sh_entsize    uint64 // or 32
+}
+
+// A string table is just an sequence null-terminated strings.
+// The first element of the string table is null (used for non-existent names).
+type StringTable []byte
+
+type ElfFile struct {
+	Body   []byte
+	Header ElfFileHeader
+	Phdrs  []ProgramHeader
+	Shdrs  []SectionHeader
+}
+
+type Elf32Rel struct {
+	R_off  uint32
+	R_info uint32
+}
+
+type Elf64Rela struct {
+	R_off    uint64
+	R_info   uint64
+	R_addend int64
+}
+
+type SymbolTableEntry struct {
+	St_name_index uint32
+	St_name       string
+	St_info       uint8
+	St_other      uint8
+	// read as a uint16. For SHN_XINDEX, the section index is in
+	// St_xshndx instead (read from the SHT_SYMTAB_SHNDX section).
+	St_shndx elf.SectionIndex
+	St_value uint64 // or uint32
+	St_size  uint64 // or uint32
+	// The section index for St_shndx == SHN_XINDEX.
+	St_xshndx uint32
+}
+
+type SymbolTable []SymbolTableEntry
+
+// The index of the section which defines the symbol, and whether there
+// is one (undefined, absolute and common symbols don't have a section).
+// Section indices above SHN_LORESERVE are only given by SHN_XINDEX, so
+// use this instead of comparing St_shndx to the section count.
+func (s *SymbolTableEntry) Section() (int, bool) {
+	if s.St_shndx == elf.SHN_XINDEX {
+		return int(s.St_xshndx), true
+	}
+	if s.St_shndx == elf.SHN_UNDEF || s.St_shndx >= elf.SHN_LORESERVE {
+		return 0, false
+	}
+	return int(s.St_shndx), true
+}
+
+func (h *ElfFileHeader) String() string {
+	return fmt.Sprintf("ELF Header:\n"+
+		"  Class: %s\n"+
+		"  Data: %s\n"+
+		"  Version: %s\n"+
+		"  OS/ABI: %s\n"+
+		"  ABI Version: %d\n"+
+		"  Type: %s\n"+
+		"  Machine: %s\n"+
+		"  Version: %d\n"+
+		"  Entry point address: 0x%x\n"+
+		"  Start of program headers: %d (bytes into file)\n"+
+		"  Start of section headers: %d (bytes into file)\n"+
+		"  Flags: 0x%x\n"+
+		"  Size of this header: %d\n"+
+		"  Size of program headers: %d\n"+
+		"  Number of program headers: %d\n"+
+		"  Size of section headers: %d\n"+
+		"  Number of section headers: %d\n"+
+		"  Section header string table index: %d\n",
+		h.Class, h.Data, h.EI_Version, h.OSABI, h.ABIVersion, h.Type,
+		h.Machine, h.E_Version, h.Entry, h.Phoff, h.Shoff, h.Flags,
+		h.FileHeaderSize, h.Phentsize, h.Phnum,
+		h.Shentsize, h.Shnum, h.Shstrndx)
+}
+
+func ToByteOrder(d elf.Data) binary.ByteOrder {
+	var b binary.ByteOrder
+	if d == elf.ELFDATA2LSB {
+		b = binary.LittleEndian
+	} else if d == elf.ELFDATA2MSB {
+		b = binary.BigEndian
+	} else {
+		panic("Unknown byte order")
+	}
+	return b
+}
+
+// Read portion of the ELF file header that depends on the ELF class,
+// returning the rounded-up fields.
+func ReadElfHeaderWithClass(
+	byte_reader io.Reader, class elf.Class, byte_order binary.ByteOrder) (
+	entry uint64, phoff uint64, shoff uint64, err error) {
+	switch class {
+	case elf.ELFCLASS32:
+		var e32, ph32, sh32 uint32
+		err1 := binary.Read(byte_reader, byte_order, &e32)
+		err2 := binary.Read(byte_reader, byte_order, &ph32)
+		err3 := binary.Read(byte_reader, byte_order, &sh32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return 0, 0, 0, ErrorAt(0x18, "failed to read ELF header")
+		}
+		return uint64(e32), uint64(ph32), uint64(sh32), nil
+	case elf.ELFCLASS64:
+		err1 := binary.Read(byte_reader, byte_order, &entry)
+		err2 := binary.Read(byte_reader, byte_order, &phoff)
+		err3 := binary.Read(byte_reader, byte_order, &shoff)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return 0, 0, 0, ErrorAt(0x18, "failed to read ELF header")
+		}
+		return entry, phoff, shoff, nil
+	default:
+		return 0, 0, 0, ErrorAt(4, "unknown ELF class %d", class)
+	}
+}
+
+func ReadElfHeader(buf []byte) (ElfFileHeader, error) {
+	if len(buf) < 16 || string(buf[:4]) != ELF_MAGIC {
+		return ElfFileHeader{}, ErrorAt(0, "not an ELF file")
+	}
+	class := elf.Class(buf[4])
+	data := elf.Data(buf[5])
+	ei_ver := elf.Version(buf[6])
+	osabi := elf.OSABI(buf[7])
+	abi_ver := uint8(buf[8])
+	if data != elf.ELFDATA2LSB && data != elf.ELFDATA2MSB {
+		return ElfFileHeader{}, ErrorAt(5, "unknown ELF byte order %d", data)
+	}
+	byte_order := ToByteOrder(data)
+	// Initialize part of the struct for now (the non-byte-order dependent bits)
+	header := ElfFileHeader{
+		Class:      class,
+		Data:       data,
+		EI_Version: ei_ver,
+		OSABI:      osabi,
+		ABIVersion: abi_ver}
+	byte_reader := bytes.NewReader(buf[16:])
+	err1 := binary.Read(byte_reader, byte_order, &header.Type)
+	err2 := binary.Read(byte_reader, byte_order, &header.Machine)
+	err3 := binary.Read(byte_reader, byte_order, &header.E_Version)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return header, ErrorAt(0x10, "failed to read ELF machine")
+	}
+	var err error
+	header.Entry, header.Phoff, header.Shoff, err = ReadElfHeaderWithClass(
+		byte_reader, class, byte_order)
+	if err != nil {
+		return header, err
+	}
+	err1 = binary.Read(byte_reader, byte_order, &header.Flags)
+	err2 = binary.Read(byte_reader, byte_order, &header.FileHeaderSize)
+	err3 = binary.Read(byte_reader, byte_order, &header.Phentsize)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return header, ErrorAt(int64(len(buf))-int64(byte_reader.Len()),
+			"failed to read ELF flags, header size, or phentsize")
+	}
+	err1 = binary.Read(byte_reader, byte_order, &header.Phnum)
+	err2 = binary.Read(byte_reader, byte_order, &header.Shentsize)
+	err3 = binary.Read(byte_reader, byte_order, &header.Shnum)
+	err4 := binary.Read(byte_reader, byte_order, &header.Shstrndx)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return header, ErrorAt(int64(len(buf))-int64(byte_reader.Len()),
+			"failed to read ELF phnum, shentsize, shnum, or shstrndx")
+	}
+	return header, nil
+}
+
+func readPhdr32(buf []byte, byte_order binary.ByteOrder) (ProgramHeader,
+	error) {
+	byte_reader := bytes.NewReader(buf)
+	phdr := ProgramHeader{}
+	// binary.Read doesn't like elf.ProgType == int, so read that
+	// to a local instead.
+	var typ uint32
+	err1 := binary.Read(byte_reader, byte_order, &typ)
+	if err1 != nil {
+		return phdr, errors.New("failed to read phdr type")
+	}
+	phdr.P_type = elf.ProgType(typ)
+	var offset, vaddr, paddr, filesz, memsz, flags, align uint32
+	err1 = binary.Read(byte_reader, byte_order, &offset)
+	err2 := binary.Read(byte_reader, byte_order, &vaddr)
+	err3 := binary.Read(byte_reader, byte_order, &paddr)
+	err4 := binary.Read(byte_reader, byte_order, &filesz)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return phdr, errors.New(
+			"failed to read phdr offset, vaddr, paddr, or filesz")
+	}
+	err1 = binary.Read(byte_reader, byte_order, &memsz)
+	err2 = binary.Read(byte_reader, byte_order, &flags)
+	err3 = binary.Read(byte_reader, byte_order, &align)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return phdr, errors.New("failed to read phdr memsz, flags, or align")
+	}
+	phdr.P_flags = elf.ProgFlag(flags)
+	phdr.P_offset = uint64(offset)
+	phdr.P_vaddr = uint64(vaddr)
+	phdr.P_paddr = uint64(paddr)
+	phdr.P_vaddr = uint64(vaddr)
+	phdr.P_filesz = uint64(filesz)
+	phdr.P_memsz = uint64(memsz)
+	phdr.P_align = uint64(align)
+	return phdr, nil
+}
+
+func readPhdr64(buf []byte, byte_order binary.ByteOrder) (ProgramHeader,
+	error) {
+	byte_reader := bytes.NewReader(buf)
+	phdr := ProgramHeader{}
+	var typ uint32
+	err1 := binary.Read(byte_reader, byte_order, &typ)
+	err2 := binary.Read(byte_reader, byte_order, &phdr.P_flags)
+	err3 := binary.Read(byte_reader, byte_order, &phdr.P_offset)
+	err4 := binary.Read(byte_reader, byte_order, &phdr.P_vaddr)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return phdr, errors.New(
+			"failed to read phdr type, flags, offset, or vaddr")
+	}
+	phdr.P_type = elf.ProgType(typ)
+	err1 = binary.Read(byte_reader, byte_order, &phdr.P_paddr)
+	err2 = binary.Read(byte_reader, byte_order, &phdr.P_filesz)
+	err3 = binary.Read(byte_reader, byte_order, &phdr.P_memsz)
+	err4 = binary.Read(byte_reader, byte_order, &phdr.P_align)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return phdr, errors.New(
+			"failed to read phdr paddr, filesz, memsz, or align")
+	}
+	return phdr, nil
+}
+
+// Read in the program headers of the program.
+func ReadProgramHeaders(
+	buf []byte, fhdr *ElfFileHeader) ([]ProgramHeader, error) {
+	counts, err := readHeaderCounts(buf, fhdr)
+	if err != nil {
+		return nil, err
+	}
+	byte_order := ToByteOrder(fhdr.Data)
+	var reader_func func([]byte, binary.ByteOrder) (ProgramHeader, error)
+	if fhdr.Class == elf.ELFCLASS32 {
+		reader_func = readPhdr32
+	} else if fhdr.Class == elf.ELFCLASS64 {
+		reader_func = readPhdr64
+	} else {
+		return nil, ErrorAt(4, "unknown ELF class %d", fhdr.Class)
+	}
+	offset := fhdr.Phoff
+	if offset == 0 {
+		return []ProgramHeader{}, nil
+	}
+	table_size, ok := tableSize(buf, counts.phnum, fhdr.Phentsize)
+	if _, in_file := sliceAt(buf, offset, table_size); !ok || !in_file {
+		return nil, ErrorAt(0, "program headers (0x%x bytes at 0x%x) run "+
+			"past the end of the file (0x%x bytes)", table_size, offset,
+			len(buf))
+	}
+	phdrs := make([]ProgramHeader, 0, counts.phnum)
+	for i := 0; i < int(counts.phnum); i++ {
+		new_phdr, err := reader_func(
+			buf[offset:offset+uint64(fhdr.Phentsize)], byte_order)
+		if err != nil {
+			return nil, ErrorAt(int64(offset), "program header %d: %s", i, err)
+		}
+		phdrs = append(phdrs, new_phdr)
+		offset += uint64(fhdr.Phentsize)
+	}
+	return phdrs, nil
+}
+
+func readShdr32(buf []byte, byte_order binary.ByteOrder) (SectionHeader,
+	error) {
+	byte_reader := bytes.NewReader(buf)
+	shdr := SectionHeader{}
+	err1 := binary.Read(byte_reader, byte_order, &shdr.Sh_name_index)
+	err2 := binary.Read(byte_reader, byte_order, &shdr.Sh_type)
+	if err1 != nil || err2 != nil {
+		return shdr, errors.New("failed to read shdr name-index, or type")
+	}
+	var flags, addr, offset, size uint32
+	err1 = binary.Read(byte_reader, byte_order, &flags)
+	err2 = binary.Read(byte_reader, byte_order, &addr)
+	err3 := binary.Read(byte_reader, byte_order, &offset)
+	err4 := binary.Read(byte_reader, byte_order, &size)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return shdr, errors.New(
+			"failed to read shdr flags, addr, offset, or size")
+	}
+	shdr.Sh_flags = elf.SectionFlag(flags)
+	shdr.Sh_addr = uint64(addr)
+	shdr.Sh_offset = uint64(offset)
+	shdr.Sh_size = uint64(size)
+	var addralign, entsize uint32
+	err1 = binary.Read(byte_reader, byte_order, &shdr.Sh_link)
+	err2 = binary.Read(byte_reader, byte_order, &shdr.Sh_info)
+	err3 = binary.Read(byte_reader, byte_order, &addralign)
+	err4 = binary.Read(byte_reader, byte_order, &entsize)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return shdr, errors.New(
+			"failed to read shdr link, info, addralign, or entsize")
+	}
+	shdr.Sh_addralign = uint64(addralign)
+	shdr.Sh_entsize = uint64(entsize)
+	return shdr, nil
+}
+
+func readShdr64(buf []byte, byte_order binary.ByteOrder) (SectionHeader,
+	error) {
+	byte_reader := bytes.NewReader(buf)
+	shdr := SectionHeader{}
+	err1 := binary.Read(byte_reader, byte_order, &shdr.Sh_name_index)
+	err2 := binary.Read(byte_reader, byte_order, &shdr.Sh_type)
+	if err1 != nil || err2 != nil {
+		return shdr, errors.New("failed to read shdr name-index, or type")
+	}
+	var flags uint64
+	err1 = binary.Read(byte_reader, byte_order, &flags)
+	err2 = binary.Read(byte_reader, byte_order, &shdr.Sh_addr)
+	err3 := binary.Read(byte_reader, byte_order, &shdr.Sh_offset)
+	err4 := binary.Read(byte_reader, byte_order, &shdr.Sh_size)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return shdr, errors.New(
+			"failed to read shdr flags, addr, offset, or size")
+	}
+	shdr.Sh_flags = elf.SectionFlag(flags)
+	err1 = binary.Read(byte_reader, byte_order, &shdr.Sh_link)
+	err2 = binary.Read(byte_reader, byte_order, &shdr.Sh_info)
+	err3 = binary.Read(byte_reader, byte_order, &shdr.Sh_addralign)
+	err4 = binary.Read(byte_reader, byte_order, &shdr.Sh_entsize)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return shdr, errors.New(
+			"failed to read shdr link, info, addralign, or entsize")
+	}
+	return shdr, nil
+}
+
+// The slice buf[offset:offset+size], unless that runs past the end of
+// buf (or overflows).
+func sliceAt(buf []byte, offset uint64, size uint64) ([]byte, bool) {
+	if offset > uint64(len(buf)) || size > uint64(len(buf))-offset {
+		return nil, false
+	}
+	return buf[offset : offset+size], true
+}
+
+func StringFromStrtab(strtab []byte, index uint32) (string, error) {
+	if index == 0 {
+		return "", nil
+	}
+	if uint64(index) >= uint64(len(strtab)) {
+		return "", fmt.Errorf("name offset %d is past the end of the "+
+			"string table (%d bytes)", index, len(strtab))
+	}
+	name_end := bytes.IndexByte(strtab[index:], 0)
+	if name_end < 0 {
+		return "", fmt.Errorf("name at offset %d is not NUL-terminated", index)
+	}
+	return string(strtab[index : int(index)+name_end]), nil
+}
+
+func ReadSectionHeaders(buf []byte, fhdr *ElfFileHeader) ([]SectionHeader,
+	error) {
+	counts, err := readHeaderCounts(buf, fhdr)
+	if err != nil {
+		return nil, err
+	}
+	byte_order := ToByteOrder(fhdr.Data)
+	var reader_func func([]byte, binary.ByteOrder) (SectionHeader, error)
+	if fhdr.Class == elf.ELFCLASS32 {
+		reader_func = readShdr32
+	} else if fhdr.Class == elf.ELFCLASS64 {
+		reader_func = readShdr64
+	} else {
+		return nil, ErrorAt(4, "unknown ELF class %d", fhdr.Class)
+	}
+	offset := fhdr.Shoff
+	if offset == 0 {
+		return []SectionHeader{}, nil
+	}
+	table_size, ok := tableSize(buf, counts.shnum, fhdr.Shentsize)
+	if _, in_file := sliceAt(buf, offset, table_size); !ok || !in_file {
+		return nil, ErrorAt(0, "section headers (0x%x bytes at 0x%x) run "+
+			"past the end of the file (0x%x bytes)", table_size, offset,
+			len(buf))
+	}
+	shdrs := make([]SectionHeader, 0, counts.shnum)
+	for i := 0; i < int(counts.shnum); i++ {
+		new_shdr, err := reader_func(
+			buf[offset:offset+uint64(fhdr.Shentsize)], byte_order)
+		if err != nil {
+			return nil, ErrorAt(int64(offset), "section header %d: %s", i, err)
+		}
+		shdrs = append(shdrs, new_shdr)
+		offset += uint64(fhdr.Shentsize)
+	}
+	// Also read the section header string table and fill out
+	// the section names.
+	if int64(counts.shstrndx) >= int64(len(shdrs)) {
+		return nil, ErrorAt(0, "section name table index %d is out of range",
+			counts.shstrndx)
+	}
+	for i := range shdrs {
+		if err := checkSectionHeader(buf, shdrs, i); err != nil {
+			return nil, ErrorAt(int64(fhdr.Shoff)+
+				int64(i)*int64(fhdr.Shentsize), "section header %d: %s", i, err)
+		}
+	}
+	// The contents of NOBITS sections aren't checked, so check this too.
+	sh_strtab_hdr := shdrs[counts.shstrndx]
+	sh_strtab, ok := sliceAt(buf, sh_strtab_hdr.Sh_offset,
+		sh_strtab_hdr.Sh_size)
+	if !ok {
+		return nil, ErrorAt(0, "section name table %d runs past the end of "+
+			"the file", counts.shstrndx)
+	}
+	for i := range shdrs {
+		name, err := StringFromStrtab(sh_strtab, shdrs[i].Sh_name_index)
+		if err != nil {
+			return nil, ErrorAt(int64(fhdr.Shoff)+
+				int64(i)*int64(fhdr.Shentsize), "section header %d: %s", i, err)
+		}
+		shdrs[i].Sh_name = name
+	}
+	return shdrs, nil
+}
+
+// The number of program headers and section headers, and the index of
+// the section name table. When they don't fit in the file header
+// (extended numbering), they are in section header 0 instead: Sh_info
+// for Phnum == PN_XNUM, Sh_size for Shnum == 0 (with Shoff set), and
+// Sh_link for Shstrndx == SHN_XINDEX.
+type headerCounts struct {
+	phnum    uint64
+	shnum    uint64
+	shstrndx uint32
+}
+
+func readHeaderCounts(buf []byte, fhdr *ElfFileHeader) (headerCounts, error) {
+	counts := headerCounts{uint64(fhdr.Phnum), uint64(fhdr.Shnum),
+		uint32(fhdr.Shstrndx)}
+	extended := fhdr.Phnum == PN_XNUM ||
+		(fhdr.Shnum == 0 && fhdr.Shoff != 0) ||
+		elf.SectionIndex(fhdr.Shstrndx) == elf.SHN_XINDEX
+	if !extended {
+		return counts, nil
+	}
+	if fhdr.Shoff == 0 {
+		return counts, ErrorAt(0, "extended numbering without section "+
+			"header 0")
+	}
+	var reader_func func([]byte, binary.ByteOrder) (SectionHeader, error)
+	if fhdr.Class == elf.ELFCLASS32 {
+		reader_func = readShdr32
+	} else if fhdr.Class == elf.ELFCLASS64 {
+		reader_func = readShdr64
+	} else {
+		return counts, ErrorAt(4, "unknown ELF class %d", fhdr.Class)
+	}
+	slice, ok := sliceAt(buf, fhdr.Shoff, uint64(fhdr.Shentsize))
+	if !ok {
+		return counts, ErrorAt(0, "section header 0 (0x%x bytes at 0x%x) "+
+			"runs past the end of the file (0x%x bytes)", fhdr.Shentsize,
+			fhdr.Shoff, len(buf))
+	}
+	shdr0, err := reader_func(slice, ToByteOrder(fhdr.Data))
+	if err != nil {
+		return counts, ErrorAt(int64(fhdr.Shoff), "section header 0: %s", err)
+	}
+	if fhdr.Phnum == PN_XNUM {
+		counts.phnum = uint64(shdr0.Sh_info)
+	}
+	if fhdr.Shnum == 0 {
+		counts.shnum = shdr0.Sh_size
+	}
+	if elf.SectionIndex(fhdr.Shstrndx) == elf.SHN_XINDEX {
+		counts.shstrndx = shdr0.Sh_link
+	}
+	return counts, nil
+}
+
+// The size of a table of count entries of entsize bytes, and whether
+// that could fit in buf (the count comes from the file, so it may be
+// big enough to overflow, or to allocate too much for).
+func tableSize(buf []byte, count uint64, entsize uint16) (uint64, bool) {
+	if count > uint64(len(buf)) ||
+		(entsize != 0 && count > uint64(len(buf))/uint64(entsize)) {
+		return count * uint64(entsize), false
+	}
+	return count * uint64(entsize), true
+}
+
+// Check that the contents of section i are within the file, and that
+// the sections it refers to exist. The rest of the linker slices the
+// file with the section headers, and indexes the section headers with
+// Sh_link and Sh_info, without checking them again.
+func checkSectionHeader(buf []byte, shdrs []SectionHeader, i int) error {
+	shdr := &shdrs[i]
+	if shdr.Sh_type != elf.SHT_NOBITS {
+		if _, ok := sliceAt(buf, shdr.Sh_offset, shdr.Sh_size); !ok {
+			return fmt.Errorf("contents (0x%x bytes at 0x%x) run past the "+
+				"end of the file (0x%x bytes)", shdr.Sh_size, shdr.Sh_offset,
+				len(buf))
+		}
+	}
+	switch shdr.Sh_type {
+	case elf.SHT_SYMTAB, elf.SHT_DYNSYM, elf.SHT_REL, elf.SHT_RELA,
+		elf.SHT_SYMTAB_SHNDX:
+		if int64(shdr.Sh_link) >= int64(len(shdrs)) {
+			return fmt.Errorf("linked section %d is out of range",
+				shdr.Sh_link)
+		}
+	}
+	if shdr.Sh_type == elf.SHT_REL || shdr.Sh_type == elf.SHT_RELA {
+		if int64(shdr.Sh_info) >= int64(len(shdrs)) {
+			return fmt.Errorf("relocated section %d is out of range",
+				shdr.Sh_info)
+		}
+	}
+	return nil
+}
+
+// Parse the main headers of the ELF file, and return it.
+// Given these headers we can then start search for the symbol table,
+// and other sections like relocations. Errors are *InputErrors with
+// the offset of the problem (but not the file name).
+func ReadElfFile(buf []byte) (ElfFile, error) {
+	result := ElfFile{Body: buf}
+	var err error
+	if result.Header, err = ReadElfHeader(buf); err != nil {
+		return result, err
+	}
+	if result.Phdrs, err = ReadProgramHeaders(buf, &result.Header); err != nil {
+		return result, err
+	}
+	result.Shdrs, err = ReadSectionHeaders(buf, &result.Header)
+	return result, err
+}
+
+func ReadElfFileFD(f io.Reader) (ElfFile, error) {
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return ElfFile{}, err
+	}
+	return ReadElfFile(body)
+}
+
+// The contents of a relocation section with entries of entsize bytes.
+func (f *ElfFile) relocSectionContents(shndx int, typ elf.SectionType,
+	entsize uint64) ([]byte, error) {
+	sec_hdr := &f.Shdrs[shndx]
+	if sec_hdr.Sh_type != typ {
+		return nil, ErrorAt(-1, "relocation section %d is not %s. It is %s",
+			shndx, typ, sec_hdr.Sh_type)
+	}
+	slice, ok := sliceAt(f.Body, sec_hdr.Sh_offset, sec_hdr.Sh_size)
+	if !ok {
+		return nil, ErrorAt(int64(sec_hdr.Sh_offset), "relocation section "+
+			"%d runs past the end of the file", shndx)
+	}
+	if sec_hdr.Sh_size%entsize != 0 {
+		return nil, ErrorAt(int64(sec_hdr.Sh_offset), "relocation section "+
+			"%d size 0x%x is not a multiple of %d", shndx, sec_hdr.Sh_size,
+			entsize)
+	}
+	return slice, nil
+}
+
+// Reads 32-bit .rel from a given section index.
+func (f *ElfFile) ReadRel32(shndx int) ([]Elf32Rel, error) {
+	slice, err := f.relocSectionContents(shndx, elf.SHT_REL, 8)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Elf32Rel, 0, len(slice)/8)
+	byte_order := ToByteOrder(f.Header.Data)
+	byte_reader := bytes.NewReader(slice)
+	for i := 0; i < len(slice); i += 8 {
+		rel := Elf32Rel{}
+		err1 := binary.Read(byte_reader, byte_order, &rel.R_off)
+		err2 := binary.Read(byte_reader, byte_order, &rel.R_info)
+		if err1 != nil || err2 != nil {
+			return nil, ErrorAt(int64(f.Shdrs[shndx].Sh_offset)+int64(i),
+				"failed to read relocation")
+		}
+		results = append(results, rel)
+	}
+	return results, nil
+}
+
+// Reads 64-bit .rela from a given section index.
+func (f *ElfFile) ReadRela64(shndx int) ([]Elf64Rela, error) {
+	slice, err := f.relocSectionContents(shndx, elf.SHT_RELA, 24)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Elf64Rela, 0, len(slice)/24)
+	byte_order := ToByteOrder(f.Header.Data)
+	byte_reader := bytes.NewReader(slice)
+	for i := 0; i < len(slice); i += 24 {
+		rel := Elf64Rela{}
+		err1 := binary.Read(byte_reader, byte_order, &rel.R_off)
+		err2 := binary.Read(byte_reader, byte_order, &rel.R_info)
+		err3 := binary.Read(byte_reader, byte_order, &rel.R_addend)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, ErrorAt(int64(f.Shdrs[shndx].Sh_offset)+int64(i),
+				"failed to read relocation")
+		}
+		results = append(results, rel)
+	}
+	return results, nil
+}
+
+func Elf32_r_sym(r_info uint32) uint32 {
+	return uint32(r_info >> 8)
+}
+
+func Elf32_r_type(r_info uint32) uint8 {
+	return uint8(r_info)
+}
+
+func Elf64_r_sym(r_info uint64) uint32 {
+	return uint32(r_info >> 32)
+}
+
+func Elf64_r_type(r_info uint64) uint32 {
+	return uint32(r_info)
+}
+
+func St_bind(info uint8) elf.SymBind {
+	return elf.SymBind(info >> 4)
+}
+
+func St_type(info uint8) elf.SymType {
+	return elf.SymType(uint8(0xf) & info)
+}
@@ -3,25 +3,25 @@
 
 // Test ELF file utilities.
 
-package main
+package elffile
 
 import (
 	"debug/elf"
-	"fmt"
-	"os"
-	"os/exec"
 	"path"
 	"testing"
-	"time"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
 )
 
-func findSectionIndex(name string, f *ElfFile) int {
-	for i := range f.Shdrs {
-		if f.Shdrs[i].Sh_name == name {
-			return i
+// The non-local symbols of st, by name.
+func globalSymbolsForTest(st SymbolTable) map[string]*SymbolTableEntry {
+	result := make(map[string]*SymbolTableEntry)
+	for i := range st {
+		if GetSymBind(st[i].St_info) != elf.STB_LOCAL {
+			result[st[i].St_name] = &st[i]
 		}
 	}
-	panic("Cannot find section w/ name: " + name)
+	return result
 }
 
 func checkSymtabCrtbegin(t *testing.T, f *ElfFile,
@@ -31,8 +31,7 @@ func checkSymtabCrtbegin(t *testing.T, f *ElfFile,
 	// *) U __pnacl_irt_init which sets up the __nacl_read_tp function using
 	//      the startup_info auxv.
 	// *) T __pnacl_start, the entry point for PNaCl programs.
-	link_info := GetSymLinkInfo(st)
-	ht := SymLinkInfoToHash(link_info, st)
+	ht := globalSymbolsForTest(st)
 	sym, ok := ht["_pnacl_wrapper_start"]
 	ExpectEq(t, true, ok)
 	ExpectEq(t, "_pnacl_wrapper_start", sym.St_name)
@@ -47,7 +46,7 @@ func checkSymtabCrtbegin(t *testing.T, f *ElfFile,
 	ExpectEq(t, elf.SHN_UNDEF, sym.St_shndx)
 	ExpectEq(t, uint64(0), sym.St_value)
 
-	text_index := findSectionIndex(".text", f)
+	text_index := FindSectionIndexForTest(".text", f)
 	sym, ok = ht["__pnacl_start"]
 	ExpectEq(t, true, ok)
 	ExpectEq(t, "__pnacl_start", sym.St_name)
@@ -160,14 +159,15 @@ func TestRelocatableELFX8632(t *testing.T) {
 		elf_file.Shdrs[10])
 
 	// Try reading the symbol table too.
-	st := elf_file.ReadSymbols()
+	st := ReadSymbolsForTest(elf_file)
 	ExpectEq(t, 17, len(st))
 
 	// Check it more deeply.
 	checkSymtabCrtbegin(t, &elf_file, st, 0xa0, 64)
 
 	// Check the relocations for crtbegin.o
-	rels := elf_file.ReadRel32(rel_text_index)
+	rels, err := elf_file.ReadRel32(rel_text_index)
+	AssertNoError(t, err)
 	ExpectEq(t, len(rels), 2)
 
 	ExpectEq(t, uint32(0xbc), rels[0].R_off)
@@ -281,13 +281,14 @@ func TestRelocatableELFX8664(t *testing.T) {
 			Sh_addr:  0, Sh_offset: 0x618, Sh_size: 0x13c,
 			Sh_link: 0, Sh_info: 0, Sh_addralign: 1, Sh_entsize: 0},
 		elf_file.Shdrs[10])
-	st := elf_file.ReadSymbols()
+	st := ReadSymbolsForTest(elf_file)
 	ExpectEq(t, 17, len(st))
 
 	// Check it more deeply.
 	checkSymtabCrtbegin(t, &elf_file, st, 0xa0, 64)
 
-	rels := elf_file.ReadRela64(rela_text_index)
+	rels, err := elf_file.ReadRela64(rela_text_index)
+	AssertNoError(t, err)
 	ExpectEq(t, len(rels), 3)
 
 	ExpectEq(t, uint64(0xa4), rels[0].R_off)
@@ -421,211 +422,24 @@ func TestRelocatableELFARM(t *testing.T) {
 			Sh_link: 0, Sh_info: 0, Sh_addralign: 1, Sh_entsize: 0},
 		elf_file.Shdrs[10])
 
-	st := elf_file.ReadSymbols()
+	st := ReadSymbolsForTest(elf_file)
 	ExpectEq(t, 20, len(st))
 	// Check it more deeply.
 	checkSymtabCrtbegin(t, &elf_file, st, 0x50, 72)
 
 	// Check the relocations for crtbegin.o
-	rels := elf_file.ReadRel32(rel_text_index)
+	rels, err := elf_file.ReadRel32(rel_text_index)
+	AssertNoError(t, err)
 	ExpectEq(t, len(rels), 2)
 
 	ExpectEq(t, uint32(0x6c), rels[0].R_off)
 	ExpectEq(t, uint32(0x121c), rels[0].R_info)
 	ExpectEq(t, "__pnacl_init_irt", st[Elf32_r_sym(rels[0].R_info)].St_name)
-	ExpectEq(t, elf.R_ARM_PLT32 + 1, // Should be R_ARM_CALL...
-		elf.R_ARM(Elf32_r_type(rels[0].R_info)))
+	ExpectEq(t, elf.R_ARM_CALL, elf.R_ARM(Elf32_r_type(rels[0].R_info)))
 
 	ExpectEq(t, uint32(0x7c), rels[1].R_off)
 	ExpectEq(t, uint32(0x131c), rels[1].R_info)
 	ExpectEq(t, "_pnacl_wrapper_start",
 		st[Elf32_r_sym(rels[1].R_info)].St_name)
-	ExpectEq(t, elf.R_ARM_PLT32 + 1, // Should be R_ARM_CALL...
-		elf.R_ARM(Elf32_r_type(rels[1].R_info)))
-}
-
-func alignTo(addr uint64, alignment uint64) uint64 {
-	diff := (alignment - (addr % alignment)) % alignment
-	return addr + diff
-}
-
-func checkExecutableX8632NaCl(t *testing.T, fname string) {
-	elf_file := ReadElfFileFname(fname)
-	ExpectEq(t, elf.ELFCLASS32, elf_file.Header.Class)
-	ExpectEq(t, elf.ELFDATA2LSB, elf_file.Header.Data)
-	ExpectEq(t, elf.EV_CURRENT, elf_file.Header.EI_Version)
-	ExpectEq(t, elf.ELFOSABI_NONE, elf_file.Header.OSABI)
-	ExpectEq(t, uint8(0), elf_file.Header.ABIVersion)
-	ExpectEq(t, elf.ET_EXEC, elf_file.Header.Type)
-	ExpectEq(t, elf.EM_386, elf_file.Header.Machine)
-	ExpectEq(t, 6, len(elf_file.Phdrs))
-
-	// Check Phdrs
-	ExpectEq(t, elf_file.Phdrs[0].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[0].P_flags, elf.PF_R|elf.PF_X)
-	ExpectEq(t, elf_file.Phdrs[0].P_offset, uint64(0x10000))
-	ExpectEq(t, elf_file.Phdrs[0].P_vaddr, uint64(0x20000))
-	ExpectEq(t, elf_file.Phdrs[0].P_paddr, uint64(0x20000))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
-
-	ExpectEq(t, elf_file.Phdrs[1].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[1].P_flags, elf.PF_R)
-	ExpectEq(t, elf_file.Phdrs[1].P_offset, uint64(0))
-	ExpectEq(t, elf_file.Phdrs[1].P_vaddr, uint64(0x10020000))
-	ExpectEq(t, elf_file.Phdrs[1].P_paddr, uint64(0x10020000))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[1].P_align, uint64(0x10000))
-
-	ExpectEq(t, elf_file.Phdrs[2].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[2].P_flags, elf.PF_R|elf.PF_W)
-	// relative to the size of the previous segment.
-	ExpectEq(t, elf_file.Phdrs[2].P_offset,
-		alignTo(elf_file.Phdrs[1].P_filesz, 32))
-	ExpectEq(t, elf_file.Phdrs[2].P_vaddr,
-		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
-	ExpectEq(t, elf_file.Phdrs[2].P_paddr,
-		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
-}
-
-func checkExecutableX8664NaCl(t *testing.T, fname string) {
-	elf_file := ReadElfFileFname(fname)
-	ExpectEq(t, elf.ELFCLASS64, elf_file.Header.Class)
-	ExpectEq(t, elf.ELFDATA2LSB, elf_file.Header.Data)
-	ExpectEq(t, elf.EV_CURRENT, elf_file.Header.EI_Version)
-	ExpectEq(t, elf.ELFOSABI_NONE, elf_file.Header.OSABI)
-	ExpectEq(t, uint8(0), elf_file.Header.ABIVersion)
-	ExpectEq(t, elf.ET_EXEC, elf_file.Header.Type)
-	ExpectEq(t, elf.EM_X86_64, elf_file.Header.Machine)
-	ExpectEq(t, 6, len(elf_file.Phdrs))
-
-	// Check Phdrs
-	ExpectEq(t, elf_file.Phdrs[0].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[0].P_flags, elf.PF_R|elf.PF_X)
-	ExpectEq(t, elf_file.Phdrs[0].P_offset, uint64(0x10000))
-	ExpectEq(t, elf_file.Phdrs[0].P_vaddr, uint64(0x20000))
-	ExpectEq(t, elf_file.Phdrs[0].P_paddr, uint64(0x20000))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
-
-	ExpectEq(t, elf_file.Phdrs[1].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[1].P_flags, elf.PF_R)
-	ExpectEq(t, elf_file.Phdrs[1].P_offset, uint64(0))
-	ExpectEq(t, elf_file.Phdrs[1].P_vaddr, uint64(0x10020000))
-	ExpectEq(t, elf_file.Phdrs[1].P_paddr, uint64(0x10020000))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[1].P_align, uint64(0x10000))
-
-	ExpectEq(t, elf_file.Phdrs[2].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[2].P_flags, elf.PF_R|elf.PF_W)
-	// relative to the size of the previous segment.
-	ExpectEq(t, elf_file.Phdrs[2].P_offset,
-		alignTo(elf_file.Phdrs[1].P_filesz, 32))
-	ExpectEq(t, elf_file.Phdrs[2].P_vaddr,
-		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
-	ExpectEq(t, elf_file.Phdrs[2].P_paddr,
-		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
-}
-
-func checkExecutableARMNaCl(t *testing.T, fname string) {
-	elf_file := ReadElfFileFname(fname)
-	ExpectEq(t, elf.ELFCLASS32, elf_file.Header.Class)
-	ExpectEq(t, elf.ELFDATA2LSB, elf_file.Header.Data)
-	ExpectEq(t, elf.EV_CURRENT, elf_file.Header.EI_Version)
-	ExpectEq(t, elf.ELFOSABI_NONE, elf_file.Header.OSABI)
-	ExpectEq(t, uint8(0), elf_file.Header.ABIVersion)
-	ExpectEq(t, elf.ET_EXEC, elf_file.Header.Type)
-	ExpectEq(t, elf.EM_ARM, elf_file.Header.Machine)
-	// The ARM one doesn't have a GNU_STACK segment so it's only 5 segments.
-	ExpectEq(t, 5, len(elf_file.Phdrs))
-
-	// Check Phdrs
-	ExpectEq(t, elf_file.Phdrs[0].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[0].P_flags, elf.PF_R|elf.PF_X)
-	ExpectEq(t, elf_file.Phdrs[0].P_offset, uint64(0x10000))
-	ExpectEq(t, elf_file.Phdrs[0].P_vaddr, uint64(0x20000))
-	ExpectEq(t, elf_file.Phdrs[0].P_paddr, uint64(0x20000))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
-
-	ExpectEq(t, elf_file.Phdrs[1].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[1].P_flags, elf.PF_R)
-	ExpectEq(t, elf_file.Phdrs[1].P_offset, uint64(0))
-	ExpectEq(t, elf_file.Phdrs[1].P_vaddr, uint64(0x10020000))
-	ExpectEq(t, elf_file.Phdrs[1].P_paddr, uint64(0x10020000))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[1].P_align, uint64(0x10000))
-
-	ExpectEq(t, elf_file.Phdrs[2].P_type, elf.PT_LOAD)
-	ExpectEq(t, elf_file.Phdrs[2].P_flags, elf.PF_R|elf.PF_W)
-	// relative to the size of the previous segment.
-	// TODO(jvoung): what is the alignment requirement???
-	ExpectEq(t, elf_file.Phdrs[2].P_offset,
-		alignTo(elf_file.Phdrs[1].P_filesz, 8))
-	ExpectEq(t, elf_file.Phdrs[2].P_vaddr,
-		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 8))
-	ExpectEq(t, elf_file.Phdrs[2].P_paddr,
-		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 8))
-	// Skip the sizes, because they can change.
-	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
-}
-
-func lastModTime(files []string, can_skip bool) time.Time {
-	t := time.Time{}
-	for _, fname := range files {
-		stat, err := os.Stat(fname)
-		if err != nil {
-			if can_skip {
-				continue
-			} else {
-				panic("Failed to stat: " + fname)
-			}
-		}
-		if stat.ModTime().After(t) {
-			t = stat.ModTime()
-		}
-	}
-	return t
-}
-
-func naclTestDataOld(infiles, outfiles []string) bool {
-	max_in_mod := lastModTime(infiles, false)
-	max_out_mod := lastModTime(outfiles, true)
-	return max_in_mod.After(max_out_mod)
-}
-
-func TestNaClExecutable(t *testing.T) {
-	// Use the test_binary shell script to generate a NaCl .nexe
-	// then read it.
-	infiles := []string{path.Join(TestBaseDir, "test_relocs.sh"),
-		path.Join(TestBaseDir, "test_relocs.c")}
-	outdirs := []string{TestX8632BaseDir(), TestX8664BaseDir(),
-		TestARMBaseDir()}
-	outfiles := []string{"test_relocs.o",
-		"test_relocs.nexe",
-		"test_relocs.nexe---test_relocs.final.pexe---.o"}
-	joined_of := []string{}
-	for _, od := range outdirs {
-		for _, of := range outfiles {
-			joined_of = append(joined_of, path.Join(od, of))
-		}
-	}
-	if naclTestDataOld(infiles, joined_of) {
-		fmt.Println("Need to regenerate relocs test binaries: test_relocs.sh")
-		cmd := exec.Command(path.Join(TestBaseDir, "test_relocs.sh"))
-		err := cmd.Run()
-		if err != nil {
-			t.Fatal(err)
-		}
-	}
-	checkExecutableX8632NaCl(
-		t, path.Join(TestX8632BaseDir(), "test_relocs.nexe"))
-	checkExecutableX8664NaCl(
-		t, path.Join(TestX8664BaseDir(), "test_relocs.nexe"))
-	checkExecutableARMNaCl(
-		t, path.Join(TestARMBaseDir(), "test_relocs.nexe"))
+	ExpectEq(t, elf.R_ARM_CALL, elf.R_ARM(Elf32_r_type(rels[1].R_info)))
 }
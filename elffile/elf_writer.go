@@ -0,0 +1,239 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Serialize an ElfFile (file header, program headers and section headers)
+// back to bytes. The inverse of the readers in elf_file.go.
+
+package elffile
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// Write out the portion of the ELF file header that depends on the ELF class.
+func writeElfHeaderWithClass(
+	w io.Writer, class elf.Class, byte_order binary.ByteOrder,
+	entry uint64, phoff uint64, shoff uint64) {
+	switch class {
+	default:
+		panic("Unknown ELF class " + class.String())
+	case elf.ELFCLASS32:
+		binary.Write(w, byte_order, uint32(entry))
+		binary.Write(w, byte_order, uint32(phoff))
+		binary.Write(w, byte_order, uint32(shoff))
+	case elf.ELFCLASS64:
+		binary.Write(w, byte_order, entry)
+		binary.Write(w, byte_order, phoff)
+		binary.Write(w, byte_order, shoff)
+	}
+}
+
+// Serialize the ELF file header, including the e_ident bytes.
+func WriteElfHeader(h *ElfFileHeader) []byte {
+	byte_order := ToByteOrder(h.Data)
+	var buf bytes.Buffer
+	ident := make([]byte, 16)
+	copy(ident, ELF_MAGIC)
+	ident[4] = byte(h.Class)
+	ident[5] = byte(h.Data)
+	ident[6] = byte(h.EI_Version)
+	ident[7] = byte(h.OSABI)
+	ident[8] = h.ABIVersion
+	buf.Write(ident)
+	binary.Write(&buf, byte_order, uint16(h.Type))
+	binary.Write(&buf, byte_order, uint16(h.Machine))
+	binary.Write(&buf, byte_order, h.E_Version)
+	writeElfHeaderWithClass(&buf, h.Class, byte_order,
+		h.Entry, h.Phoff, h.Shoff)
+	binary.Write(&buf, byte_order, h.Flags)
+	binary.Write(&buf, byte_order, h.FileHeaderSize)
+	binary.Write(&buf, byte_order, h.Phentsize)
+	binary.Write(&buf, byte_order, h.Phnum)
+	binary.Write(&buf, byte_order, h.Shentsize)
+	binary.Write(&buf, byte_order, h.Shnum)
+	binary.Write(&buf, byte_order, h.Shstrndx)
+	return buf.Bytes()
+}
+
+func writePhdr32(w io.Writer, byte_order binary.ByteOrder,
+	phdr *ProgramHeader) {
+	binary.Write(w, byte_order, uint32(phdr.P_type))
+	binary.Write(w, byte_order, uint32(phdr.P_offset))
+	binary.Write(w, byte_order, uint32(phdr.P_vaddr))
+	binary.Write(w, byte_order, uint32(phdr.P_paddr))
+	binary.Write(w, byte_order, uint32(phdr.P_filesz))
+	binary.Write(w, byte_order, uint32(phdr.P_memsz))
+	// For ELFCLASS32, flags come after memsz.
+	binary.Write(w, byte_order, uint32(phdr.P_flags))
+	binary.Write(w, byte_order, uint32(phdr.P_align))
+}
+
+func writePhdr64(w io.Writer, byte_order binary.ByteOrder,
+	phdr *ProgramHeader) {
+	binary.Write(w, byte_order, uint32(phdr.P_type))
+	binary.Write(w, byte_order, uint32(phdr.P_flags))
+	binary.Write(w, byte_order, phdr.P_offset)
+	binary.Write(w, byte_order, phdr.P_vaddr)
+	binary.Write(w, byte_order, phdr.P_paddr)
+	binary.Write(w, byte_order, phdr.P_filesz)
+	binary.Write(w, byte_order, phdr.P_memsz)
+	binary.Write(w, byte_order, phdr.P_align)
+}
+
+// Serialize the program headers, each taking up fhdr.Phentsize bytes.
+func WriteProgramHeaders(phdrs []ProgramHeader, fhdr *ElfFileHeader) []byte {
+	byte_order := ToByteOrder(fhdr.Data)
+	var writer_func func(io.Writer, binary.ByteOrder, *ProgramHeader)
+	if fhdr.Class == elf.ELFCLASS32 {
+		writer_func = writePhdr32
+	} else if fhdr.Class == elf.ELFCLASS64 {
+		writer_func = writePhdr64
+	} else {
+		panic("Unknown ELF class")
+	}
+	result := make([]byte, 0, len(phdrs)*int(fhdr.Phentsize))
+	for i := range phdrs {
+		var buf bytes.Buffer
+		writer_func(&buf, byte_order, &phdrs[i])
+		result = append(result, padTo(buf.Bytes(), int(fhdr.Phentsize))...)
+	}
+	return result
+}
+
+func writeShdr32(w io.Writer, byte_order binary.ByteOrder,
+	shdr *SectionHeader) {
+	binary.Write(w, byte_order, shdr.Sh_name_index)
+	binary.Write(w, byte_order, uint32(shdr.Sh_type))
+	binary.Write(w, byte_order, uint32(shdr.Sh_flags))
+	binary.Write(w, byte_order, uint32(shdr.Sh_addr))
+	binary.Write(w, byte_order, uint32(shdr.Sh_offset))
+	binary.Write(w, byte_order, uint32(shdr.Sh_size))
+	binary.Write(w, byte_order, shdr.Sh_link)
+	binary.Write(w, byte_order, shdr.Sh_info)
+	binary.Write(w, byte_order, uint32(shdr.Sh_addralign))
+	binary.Write(w, byte_order, uint32(shdr.Sh_entsize))
+}
+
+func writeShdr64(w io.Writer, byte_order binary.ByteOrder,
+	shdr *SectionHeader) {
+	binary.Write(w, byte_order, shdr.Sh_name_index)
+	binary.Write(w, byte_order, uint32(shdr.Sh_type))
+	binary.Write(w, byte_order, uint64(shdr.Sh_flags))
+	binary.Write(w, byte_order, shdr.Sh_addr)
+	binary.Write(w, byte_order, shdr.Sh_offset)
+	binary.Write(w, byte_order, shdr.Sh_size)
+	binary.Write(w, byte_order, shdr.Sh_link)
+	binary.Write(w, byte_order, shdr.Sh_info)
+	binary.Write(w, byte_order, shdr.Sh_addralign)
+	binary.Write(w, byte_order, shdr.Sh_entsize)
+}
+
+// Serialize the section headers, each taking up fhdr.Shentsize bytes.
+// Only Sh_name_index is written for the name, so the string itself
+// must already be in the section header string table.
+func WriteSectionHeaders(shdrs []SectionHeader, fhdr *ElfFileHeader) []byte {
+	byte_order := ToByteOrder(fhdr.Data)
+	var writer_func func(io.Writer, binary.ByteOrder, *SectionHeader)
+	if fhdr.Class == elf.ELFCLASS32 {
+		writer_func = writeShdr32
+	} else if fhdr.Class == elf.ELFCLASS64 {
+		writer_func = writeShdr64
+	} else {
+		panic("Unknown ELF class")
+	}
+	result := make([]byte, 0, len(shdrs)*int(fhdr.Shentsize))
+	for i := range shdrs {
+		var buf bytes.Buffer
+		writer_func(&buf, byte_order, &shdrs[i])
+		result = append(result, padTo(buf.Bytes(), int(fhdr.Shentsize))...)
+	}
+	return result
+}
+
+// Set Phnum, Shnum and Shstrndx in the file header from the program
+// and section headers, and the index of the section name table. The
+// values which don't fit in the file header are put in section header 0
+// instead (extended numbering, see headerCounts), so that must be the
+// null section when there are that many.
+func (f *ElfFile) SetHeaderCounts(shstrndx int) {
+	phnum, shnum := len(f.Phdrs), len(f.Shdrs)
+	extended := phnum >= PN_XNUM || shnum >= int(elf.SHN_LORESERVE) ||
+		shstrndx >= int(elf.SHN_LORESERVE)
+	if extended && shnum == 0 {
+		panic("Extended numbering without section header 0")
+	}
+	f.Header.Phnum = uint16(phnum)
+	if phnum >= PN_XNUM {
+		f.Header.Phnum = PN_XNUM
+		f.Shdrs[0].Sh_info = uint32(phnum)
+	}
+	f.Header.Shnum = uint16(shnum)
+	if shnum >= int(elf.SHN_LORESERVE) {
+		f.Header.Shnum = 0
+		f.Shdrs[0].Sh_size = uint64(shnum)
+	}
+	f.Header.Shstrndx = uint16(shstrndx)
+	if shstrndx >= int(elf.SHN_LORESERVE) {
+		f.Header.Shstrndx = uint16(elf.SHN_XINDEX)
+		f.Shdrs[0].Sh_link = uint32(shstrndx)
+	}
+}
+
+// Pad (or truncate) an entry to the entry size given in the file header.
+func padTo(buf []byte, size int) []byte {
+	if len(buf) >= size {
+		return buf[:size]
+	}
+	return append(buf, make([]byte, size-len(buf))...)
+}
+
+// Serialize the ElfFile. The Body supplies the section and segment contents,
+// and the headers are then written over the Body at offset 0, Phoff,
+// and Shoff. The result is grown if the header tables extend past the Body.
+func WriteElfFile(f *ElfFile) []byte {
+	header := WriteElfHeader(&f.Header)
+	phdrs := WriteProgramHeaders(f.Phdrs, &f.Header)
+	shdrs := WriteSectionHeaders(f.Shdrs, &f.Header)
+	size := uint64(len(f.Body))
+	if uint64(len(header)) > size {
+		size = uint64(len(header))
+	}
+	if len(phdrs) > 0 && f.Header.Phoff+uint64(len(phdrs)) > size {
+		size = f.Header.Phoff + uint64(len(phdrs))
+	}
+	if len(shdrs) > 0 && f.Header.Shoff+uint64(len(shdrs)) > size {
+		size = f.Header.Shoff + uint64(len(shdrs))
+	}
+	result := make([]byte, size)
+	copy(result, f.Body)
+	copy(result, header)
+	if len(phdrs) > 0 {
+		copy(result[f.Header.Phoff:], phdrs)
+	}
+	if len(shdrs) > 0 {
+		copy(result[f.Header.Shoff:], shdrs)
+	}
+	return result
+}
+
+func WriteElfFileFD(f *ElfFile, w io.Writer) error {
+	_, err := w.Write(WriteElfFile(f))
+	return err
+}
+
+// Write the file out as an executable (or relocatable) ELF file.
+func WriteElfFileFname(f *ElfFile, fname string) error {
+	out, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if err := WriteElfFileFD(f, out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
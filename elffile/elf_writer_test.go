@@ -0,0 +1,233 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test ELF file serialization.
+
+package elffile
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func checkRoundTrip(t *testing.T, name string, buf []byte) {
+	elf_file := ReadElfFileForTest(buf)
+	out := WriteElfFile(&elf_file)
+	if !bytes.Equal(buf, out) {
+		t.Errorf("%s: Read->Write did not round-trip (%d vs %d bytes)",
+			name, len(buf), len(out))
+	}
+}
+
+// Every object and nexe in the test directories should come back out
+// byte-for-byte (see also TestWriteMembersRoundTrip).
+func TestWriteRoundTrip(t *testing.T) {
+	dirs := []string{TestX8632BaseDir(), TestX8664BaseDir(),
+		TestARMBaseDir(), TestMIPSBaseDir()}
+	checked := 0
+	for _, dir := range dirs {
+		for _, pattern := range []string{"*.o", "*.nexe"} {
+			fnames, _ := filepath.Glob(filepath.Join(dir, pattern))
+			for _, fname := range fnames {
+				buf, err := ioutil.ReadFile(fname)
+				if err != nil {
+					t.Fatal("Failed to read", fname, err)
+				}
+				checkRoundTrip(t, fname, buf)
+				checked++
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("No test files found")
+	}
+}
+
+// There are no big-endian test binaries checked in, so build a file
+// by hand and check that the headers survive Write->Read.
+func checkHeadersRoundTrip(t *testing.T, class elf.Class, data elf.Data) {
+	ehsize, phentsize, shentsize := uint16(52), uint16(32), uint16(40)
+	if class == elf.ELFCLASS64 {
+		ehsize, phentsize, shentsize = 64, 56, 64
+	}
+	shstrtab := []byte("\x00.text\x00.shstrtab\x00")
+	shstrtab_off := uint64(0x200)
+	in := ElfFile{
+		Body: make([]byte, shstrtab_off+uint64(len(shstrtab))),
+		Header: ElfFileHeader{
+			Class:          class,
+			Data:           data,
+			EI_Version:     elf.EV_CURRENT,
+			OSABI:          elf.ELFOSABI_NONE,
+			Type:           elf.ET_EXEC,
+			Machine:        elf.EM_MIPS,
+			E_Version:      1,
+			Entry:          0x20080,
+			Phoff:          uint64(ehsize),
+			Shoff:          0x300,
+			Flags:          0x70001003,
+			FileHeaderSize: ehsize,
+			Phentsize:      phentsize,
+			Phnum:          1,
+			Shentsize:      shentsize,
+			Shnum:          3,
+			Shstrndx:       2},
+		Phdrs: []ProgramHeader{{
+			P_type:   elf.PT_LOAD,
+			P_flags:  elf.PF_R | elf.PF_X,
+			P_offset: 0x100,
+			P_vaddr:  0x20000,
+			P_paddr:  0x20000,
+			P_filesz: 0x80,
+			P_memsz:  0x90,
+			P_align:  0x10000}},
+		Shdrs: []SectionHeader{
+			{},
+			{Sh_name_index: 1, Sh_name: ".text", Sh_type: elf.SHT_PROGBITS,
+				Sh_flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR,
+				Sh_addr:  0x20000, Sh_offset: 0x100, Sh_size: 0x80,
+				Sh_addralign: 32},
+			{Sh_name_index: 7, Sh_name: ".shstrtab", Sh_type: elf.SHT_STRTAB,
+				Sh_offset: shstrtab_off, Sh_size: uint64(len(shstrtab)),
+				Sh_addralign: 1}}}
+	copy(in.Body[shstrtab_off:], shstrtab)
+	buf := WriteElfFile(&in)
+	AssertEq(t, int(in.Header.Shoff)+3*int(shentsize), len(buf))
+	out := ReadElfFileForTest(buf)
+	ExpectEq(t, in.Header, out.Header)
+	AssertEq(t, len(in.Phdrs), len(out.Phdrs))
+	ExpectEq(t, in.Phdrs[0], out.Phdrs[0])
+	AssertEq(t, len(in.Shdrs), len(out.Shdrs))
+	for i := range in.Shdrs {
+		ExpectEq(t, in.Shdrs[i], out.Shdrs[i])
+	}
+	// Also make sure that the standard library agrees.
+	std_file, err := elf.NewFile(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal("debug/elf failed to parse the output:", err)
+	}
+	ExpectEq(t, data.String(), std_file.Data.String())
+	ExpectEq(t, uint64(0x20080), std_file.Entry)
+	ExpectEq(t, elf.PF_R|elf.PF_X, std_file.Progs[0].Flags)
+	ExpectEq(t, uint64(0x90), std_file.Progs[0].Memsz)
+	ExpectEq(t, ".text", std_file.Sections[1].Name)
+}
+
+func TestWriteHeaders(t *testing.T) {
+	checkHeadersRoundTrip(t, elf.ELFCLASS32, elf.ELFDATA2LSB)
+	checkHeadersRoundTrip(t, elf.ELFCLASS32, elf.ELFDATA2MSB)
+	checkHeadersRoundTrip(t, elf.ELFCLASS64, elf.ELFDATA2LSB)
+	checkHeadersRoundTrip(t, elf.ELFCLASS64, elf.ELFDATA2MSB)
+}
+
+// Files with too many sections or program headers for the file header
+// put the counts in section header 0, and symbols defined in sections
+// past SHN_LORESERVE have SHN_XINDEX and an entry in .symtab_shndx.
+func TestWriteExtendedNumbering(t *testing.T) {
+	num_sections := int(elf.SHN_LORESERVE) + 0x10
+	symtab_index := num_sections - 4
+	shstrtab_index := num_sections - 1
+	def_index := uint32(elf.SHN_LORESERVE) + 5
+	phdrs := make([]ProgramHeader, PN_XNUM)
+	shdrs := make([]SectionHeader, num_sections)
+	for i := 1; i < symtab_index; i++ {
+		shdrs[i].Sh_type = elf.SHT_PROGBITS
+	}
+
+	var data bytes.Buffer
+	data_off := 64 + uint64(len(phdrs))*56
+	addSection := func(index int, name_index uint32, name string,
+		typ elf.SectionType, link int, entsize uint64, contents []byte) {
+		shdrs[index] = SectionHeader{Sh_name_index: name_index,
+			Sh_name: name, Sh_type: typ,
+			Sh_offset: data_off + uint64(data.Len()),
+			Sh_size:   uint64(len(contents)), Sh_link: uint32(link),
+			Sh_addralign: 1, Sh_entsize: entsize}
+		data.Write(contents)
+	}
+	// A null symbol, and "sym" in section def_index.
+	var symtab bytes.Buffer
+	bo := binary.LittleEndian
+	binary.Write(&symtab, bo, make([]byte, 24))
+	binary.Write(&symtab, bo, uint32(1))
+	binary.Write(&symtab, bo, []uint8{
+		uint8(elf.STB_GLOBAL)<<4 | uint8(elf.STT_FUNC), 0})
+	binary.Write(&symtab, bo, uint16(elf.SHN_XINDEX))
+	binary.Write(&symtab, bo, []uint64{0x10, 0})
+	shndx := make([]byte, 8)
+	bo.PutUint32(shndx[4:], def_index)
+	addSection(symtab_index, 1, ".symtab", elf.SHT_SYMTAB,
+		symtab_index+1, 24, symtab.Bytes())
+	addSection(symtab_index+1, 9, ".strtab", elf.SHT_STRTAB, 0, 0,
+		[]byte("\x00sym\x00"))
+	addSection(symtab_index+2, 17, ".symtab_shndx", elf.SHT_SYMTAB_SHNDX,
+		symtab_index, 4, shndx)
+	addSection(shstrtab_index, 31, ".shstrtab", elf.SHT_STRTAB, 0, 0,
+		[]byte("\x00.symtab\x00.strtab\x00.symtab_shndx\x00.shstrtab\x00"))
+
+	in := ElfFile{
+		Body: append(make([]byte, data_off), data.Bytes()...),
+		Header: ElfFileHeader{
+			Class:          elf.ELFCLASS64,
+			Data:           elf.ELFDATA2LSB,
+			EI_Version:     elf.EV_CURRENT,
+			OSABI:          elf.ELFOSABI_NONE,
+			Type:           elf.ET_REL,
+			Machine:        elf.EM_X86_64,
+			E_Version:      1,
+			Phoff:          64,
+			Shoff:          data_off + uint64(data.Len()),
+			FileHeaderSize: 64,
+			Phentsize:      56,
+			Shentsize:      64},
+		Phdrs: phdrs,
+		Shdrs: shdrs}
+	in.SetHeaderCounts(shstrtab_index)
+	ExpectEq(t, uint16(PN_XNUM), in.Header.Phnum)
+	ExpectEq(t, uint16(0), in.Header.Shnum)
+	ExpectEq(t, uint16(elf.SHN_XINDEX), in.Header.Shstrndx)
+	ExpectEq(t, uint32(PN_XNUM), in.Shdrs[0].Sh_info)
+	ExpectEq(t, uint64(num_sections), in.Shdrs[0].Sh_size)
+	ExpectEq(t, uint32(shstrtab_index), in.Shdrs[0].Sh_link)
+
+	buf := WriteElfFile(&in)
+	out := ReadElfFileForTest(buf)
+	ExpectEq(t, in.Header, out.Header)
+	ExpectEq(t, len(in.Phdrs), len(out.Phdrs))
+	AssertEq(t, len(in.Shdrs), len(out.Shdrs))
+	for _, i := range []int{0, symtab_index, symtab_index + 1,
+		symtab_index + 2, shstrtab_index} {
+		ExpectEq(t, in.Shdrs[i], out.Shdrs[i])
+	}
+	st := ReadSymbolsForTest(out)
+	AssertEq(t, 2, len(st))
+	ExpectEq(t, "sym", st[1].St_name)
+	ExpectEq(t, elf.SHN_XINDEX, st[1].St_shndx)
+	ExpectEq(t, def_index, st[1].St_xshndx)
+	sym_shndx, ok := st[1].Section()
+	ExpectEq(t, true, ok)
+	ExpectEq(t, int(def_index), sym_shndx)
+
+	// Also make sure that the standard library agrees.
+	std_file, err := elf.NewFile(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal("debug/elf failed to parse the output:", err)
+	}
+	AssertEq(t, num_sections, len(std_file.Sections))
+	ExpectEq(t, ".shstrtab", std_file.Sections[shstrtab_index].Name)
+
+	// The SHN_XINDEX symbol needs the .symtab_shndx.
+	out.Shdrs[symtab_index+2].Sh_type = elf.SHT_PROGBITS
+	_, err = out.ReadSymbols()
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "0x"+strconv.FormatUint(in.Shdrs[symtab_index].Sh_offset+
+		24, 16)+": symbol 1: section index is SHN_XINDEX, but there is no "+
+		"SHT_SYMTAB_SHNDX section", err.Error())
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Fuzz the ELF readers, which must return errors for malformed files
+// instead of panicking. The test objects are the seeds.
+// E.g., go test -run NONE -fuzz FuzzReadElfFile ./elffile
+
+package elffile
+
+import (
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func FuzzReadElfFile(f *testing.F) {
+	AddFuzzSeeds(f, "*.o")
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		elf_file, err := ReadElfFile(buf)
+		if err != nil {
+			return
+		}
+		// The count is in section header 0 for extended numbering.
+		counts, _ := readHeaderCounts(buf, &elf_file.Header)
+		if elf_file.Header.Shoff != 0 &&
+			uint64(len(elf_file.Shdrs)) != counts.shnum {
+			t.Errorf("Read %d section headers, expected %d",
+				len(elf_file.Shdrs), counts.shnum)
+		}
+	})
+}
+
+func FuzzReadSymbols(f *testing.F) {
+	AddFuzzSeeds(f, "*.o")
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		elf_file, err := ReadElfFile(buf)
+		if err != nil {
+			return
+		}
+		st, err := elf_file.ReadSymbols()
+		if err != nil {
+			return
+		}
+		for i := range st {
+			shndx, ok := st[i].Section()
+			if ok && shndx >= len(elf_file.Shdrs) {
+				t.Errorf("Symbol %d has section index %d, but there are "+
+					"only %d sections", i, shndx, len(elf_file.Shdrs))
+			}
+		}
+		// Relocations are read along with the symbols (see ReadInputFile),
+		// and then the linker indexes the symbols with them.
+		if elf_file.CheckRelocations() != nil {
+			return
+		}
+		for j := range elf_file.Shdrs {
+			if !IsRelocSection(&elf_file.Shdrs[j]) {
+				continue
+			}
+			rels, _ := elf_file.ReadRelocations(j)
+			for _, rel := range rels {
+				if int(rel.Sym) >= len(st) {
+					t.Errorf("Relocation of section %d has symbol %d, but "+
+						"there are only %d symbols", j, rel.Sym, len(st))
+				}
+			}
+		}
+	})
+}
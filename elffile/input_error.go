@@ -0,0 +1,77 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Errors from reading the input files. The readers work on buffers and
+// only know the offset of a problem, so the file name (and archive
+// member) are filled in by the callers which know them.
+
+package elffile
+
+import (
+	"fmt"
+)
+
+// A problem with an input file: the file, the archive member (if the
+// problem is in a member), and the byte offset of the problem within
+// the file, or within the member. Offset is -1 if it isn't known.
+type InputError struct {
+	File   string
+	Member string
+	Offset int64
+	Err    error
+}
+
+func (e *InputError) Error() string {
+	where := e.File
+	if e.Member != "" {
+		where += "(" + e.Member + ")"
+	}
+	if e.Offset >= 0 {
+		if where != "" {
+			where += ":"
+		}
+		where += fmt.Sprintf("0x%x", e.Offset)
+	}
+	if where == "" {
+		return e.Err.Error()
+	}
+	return where + ": " + e.Err.Error()
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// An error at the offset of a file which isn't known yet.
+func ErrorAt(offset int64, format string, args ...interface{}) error {
+	return &InputError{Offset: offset, Err: fmt.Errorf(format, args...)}
+}
+
+// An error in the file, without an offset.
+func FileError(file string, format string, args ...interface{}) error {
+	return &InputError{File: file, Offset: -1,
+		Err: fmt.Errorf(format, args...)}
+}
+
+// Fill in the file and member of an error from reading them (unless the
+// error already has a file, e.g., from a nested archive).
+func InMember(err error, file string, member string) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*InputError); ok {
+		if e.File != "" {
+			return err
+		}
+		located := *e
+		located.File = file
+		located.Member = member
+		return &located
+	}
+	return &InputError{File: file, Member: member, Offset: -1, Err: err}
+}
+
+// Fill in the file of an error from reading it.
+func InFile(err error, file string) error {
+	return InMember(err, file, "")
+}
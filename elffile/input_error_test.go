@@ -0,0 +1,170 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test the errors from reading malformed input files.
+
+package elffile
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func TestInputErrorString(t *testing.T) {
+	err := ErrorAt(0x10, "failed to read %s", "it")
+	ExpectEq(t, "0x10: failed to read it", err.Error())
+	ExpectEq(t, "a.o:0x10: failed to read it", InFile(err, "a.o").Error())
+	member_err := InMember(err, "lib.a", "a.o")
+	ExpectEq(t, "lib.a(a.o):0x10: failed to read it", member_err.Error())
+	// The innermost file is kept.
+	ExpectEq(t, member_err.Error(), InFile(member_err, "other.a").Error())
+	ExpectEq(t, "a.o: not an object", FileError("a.o", "not an object").Error())
+	ExpectEq(t, "lib.a: cannot read", InFile(errors.New("cannot read"),
+		"lib.a").Error())
+}
+
+func TestReadElfFileErrors(t *testing.T) {
+	_, err := ReadElfFile([]byte("!<arch>\n"))
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "0x0: not an ELF file", err.Error())
+	_, err = ReadElfFile([]byte("\x7fELF\x03\x01\x01\x00\x00\x00\x00\x00" +
+		"\x00\x00\x00\x00\x01\x00\x03\x00\x01\x00\x00\x00"))
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "0x4: unknown ELF class 3", err.Error())
+	// Truncated after the machine.
+	_, err = ReadElfFile([]byte("\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00" +
+		"\x00\x00\x00\x00\x01\x00\x03\x00"))
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "0x10: failed to read ELF machine", err.Error())
+
+	// Without a symbol table.
+	elf_file := ReadElfFileFname(path.Join(TestX8632BaseDir(), "crtbegin.o"))
+	elf_file.Shdrs = elf_file.Shdrs[:1]
+	_, err = elf_file.ReadSymbols()
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "no symbol table", err.Error())
+}
+
+// Malformed copies of crtbegin.o (x86-32), each with one field
+// overwritten, are rejected instead of crashing the readers.
+func TestReadElfFileBounds(t *testing.T) {
+	orig, err := ioutil.ReadFile(path.Join(TestX8632BaseDir(), "crtbegin.o"))
+	AssertNoError(t, err)
+	elf_file := ReadElfFileForTest(orig)
+	shdr_offset := func(i int) int {
+		return int(elf_file.Header.Shoff) + i*int(elf_file.Header.Shentsize)
+	}
+	rel_text_index := 3
+	rel_text := elf_file.Shdrs[rel_text_index]
+	AssertEq(t, ".rel.text", rel_text.Sh_name)
+	symtab := elf_file.Shdrs[rel_text.Sh_link]
+	AssertEq(t, ".symtab", symtab.Sh_name)
+	text := elf_file.Shdrs[rel_text.Sh_info]
+	AssertEq(t, ".text", text.Sh_name)
+	bo := binary.LittleEndian
+	tests := []struct {
+		offset   int
+		size     int
+		value    uint32
+		expected string
+	}{
+		{0x20, 4, uint32(len(orig)), "section headers (0x1b8 bytes at 0x" +
+			"5b0) run past the end of the file (0x5b0 bytes)"},
+		{shdr_offset(3) + 16, 4, 0xffffffff,
+			"section header 3: contents (0x10 bytes at 0xffffffff) run past " +
+				"the end of the file"},
+		{shdr_offset(3) + 20, 4, 7, "relocation section 3 size 0x7 is not " +
+			"a multiple of 8"},
+		{shdr_offset(3) + 24, 4, 1000,
+			"section header 3: linked section 1000 is out of range"},
+		// Linked to a section other than the symbol table (.text).
+		{shdr_offset(3) + 24, 4, 1, "relocation section .rel.text is not " +
+			"for the symbol table (linked section 1)"},
+		{shdr_offset(3) + 28, 4, 1000,
+			"section header 3: relocated section 1000 is out of range"},
+		{shdr_offset(1), 4, 0xfffffff0, "section header 1: name offset " +
+			"4294967280 is past the end of the string table"},
+		{int(symtab.Sh_offset) + 16 + 14, 2, 0xfe00,
+			"symbol 1: section index 65024 is out of range"},
+		{int(rel_text.Sh_offset) + 4, 4, 0xffffff02, "relocation 0 of " +
+			".rel.text: symbol index 16777215 is out of range"},
+		{int(rel_text.Sh_offset), 4, 0xffff, "relocation 0 of .rel.text: " +
+			"offset 0xffff is past the end of section .text"},
+		// A 4-byte place starting in the last bytes of the section.
+		{int(rel_text.Sh_offset), 4, uint32(text.Sh_size - 2),
+			fmt.Sprintf("relocation 0 of .rel.text: 4-byte place at offset "+
+				"0x%x runs past the end of section .text", text.Sh_size-2)},
+	}
+	for _, test := range tests {
+		buf := append([]byte{}, orig...)
+		if test.size == 2 {
+			bo.PutUint16(buf[test.offset:], uint16(test.value))
+		} else {
+			bo.PutUint32(buf[test.offset:], test.value)
+		}
+		f, err := ReadElfFile(buf)
+		if err == nil {
+			_, err = f.ReadSymbols()
+		}
+		if err == nil {
+			err = f.CheckRelocations()
+		}
+		AssertEqM(t, false, err == nil, test.expected)
+		ExpectEqM(t, true, strings.Contains(err.Error(), test.expected),
+			err.Error())
+	}
+}
+
+// The counts can also come from section header 0 (extended numbering),
+// which must be checked in the same way.
+func TestReadElfFileExtendedNumbering(t *testing.T) {
+	orig, err := ioutil.ReadFile(path.Join(TestX8632BaseDir(), "crtbegin.o"))
+	AssertNoError(t, err)
+	elf_file := ReadElfFileForTest(orig)
+	shoff := int(elf_file.Header.Shoff)
+	bo := binary.LittleEndian
+	header := elf_file.Header
+	header.Shnum = 0
+	header.Shstrndx = uint16(elf.SHN_XINDEX)
+
+	read := func(shnum uint32, shstrndx uint32) ([]SectionHeader, error) {
+		buf := append([]byte{}, orig...)
+		bo.PutUint32(buf[shoff+20:], shnum)
+		bo.PutUint32(buf[shoff+24:], shstrndx)
+		return ReadSectionHeaders(buf, &header)
+	}
+	shdrs, err := read(uint32(len(elf_file.Shdrs)),
+		uint32(elf_file.Header.Shstrndx))
+	AssertNoError(t, err)
+	AssertEq(t, len(elf_file.Shdrs), len(shdrs))
+	for i := 1; i < len(shdrs); i++ {
+		ExpectEq(t, elf_file.Shdrs[i], shdrs[i])
+	}
+
+	_, err = read(0xffffffff, uint32(elf_file.Header.Shstrndx))
+	AssertEq(t, false, err == nil)
+	ExpectEqM(t, true, strings.Contains(err.Error(),
+		"section headers (0x27ffffffd8 bytes at 0x19c) run past the end"),
+		err.Error())
+	_, err = read(uint32(len(elf_file.Shdrs)), 1000)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "0x0: section name table index 1000 is out of range",
+		err.Error())
+
+	// PN_XNUM needs section header 0.
+	header = elf_file.Header
+	header.Phnum = PN_XNUM
+	header.Shoff = 0
+	_, err = ReadProgramHeaders(orig, &header)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "0x0: extended numbering without section header 0",
+		err.Error())
+}
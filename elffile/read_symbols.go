@@ -0,0 +1,200 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Functions to read symbol table entries.
+// Depends on elf_file.go.
+
+package elffile
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+func readSymbolEntryPrefix(r io.Reader, bo binary.ByteOrder) (
+	SymbolTableEntry, error) {
+	st_entry := SymbolTableEntry{}
+	err1 := binary.Read(r, bo, &st_entry.St_name_index)
+	if err1 == io.EOF {
+		return st_entry, err1
+	} else if err1 != nil {
+		return st_entry, errors.New("failed to read st_name")
+	}
+	return st_entry, nil
+}
+
+func readSymbolEntry32(r io.Reader, bo binary.ByteOrder, strtab []byte) (
+	SymbolTableEntry, error) {
+	st_entry, err1 := readSymbolEntryPrefix(r, bo)
+	if err1 != nil {
+		return st_entry, err1
+	}
+	var value, size uint32
+	err1 = binary.Read(r, bo, &value)
+	err2 := binary.Read(r, bo, &size)
+	if err1 != nil || err2 != nil {
+		return st_entry, errors.New("failed to read st_value, size")
+	}
+	st_entry.St_value = uint64(value)
+	st_entry.St_size = uint64(size)
+	var shndx uint16
+	err1 = binary.Read(r, bo, &st_entry.St_info)
+	err2 = binary.Read(r, bo, &st_entry.St_other)
+	err3 := binary.Read(r, bo, &shndx)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return st_entry, errors.New("failed to read st_info, other, or shndx")
+	}
+	st_entry.St_shndx = elf.SectionIndex(shndx)
+	var err error
+	st_entry.St_name, err = StringFromStrtab(strtab, st_entry.St_name_index)
+	return st_entry, err
+}
+
+func readSymbolEntry64(r io.Reader, bo binary.ByteOrder, strtab []byte) (
+	SymbolTableEntry, error) {
+	st_entry, err1 := readSymbolEntryPrefix(r, bo)
+	if err1 != nil {
+		return st_entry, err1
+	}
+	var shndx uint16
+	err1 = binary.Read(r, bo, &st_entry.St_info)
+	err2 := binary.Read(r, bo, &st_entry.St_other)
+	err3 := binary.Read(r, bo, &shndx)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return st_entry, errors.New("failed to read st_info, other, or shndx")
+	}
+	st_entry.St_shndx = elf.SectionIndex(shndx)
+	err1 = binary.Read(r, bo, &st_entry.St_value)
+	err2 = binary.Read(r, bo, &st_entry.St_size)
+	if err1 != nil || err2 != nil {
+		return st_entry, errors.New("failed to read st_value, size")
+	}
+	var err error
+	st_entry.St_name, err = StringFromStrtab(strtab, st_entry.St_name_index)
+	return st_entry, err
+}
+
+// The index of the symbol table which ReadSymbols reads (.symtab), or -1
+// if there isn't one.
+func (f *ElfFile) symtabIndex() int {
+	for i := range f.Shdrs {
+		if f.Shdrs[i].Sh_name == ".symtab" &&
+			f.Shdrs[i].Sh_type == elf.SHT_SYMTAB {
+			return i
+		}
+	}
+	return -1
+}
+
+// Reads all the symbol-table entries from the ElfFile,
+// and figures out all the actual symbol names from the string table.
+// Errors are *InputErrors with the offset of the bad entry.
+func (f ElfFile) ReadSymbols() (SymbolTable, error) {
+	st_index := f.symtabIndex()
+	if st_index == -1 {
+		return nil, ErrorAt(-1, "no symbol table")
+	}
+	symtab_sec_hdr := f.Shdrs[st_index]
+	symtab_slice, ok := sliceAt(f.Body, symtab_sec_hdr.Sh_offset,
+		symtab_sec_hdr.Sh_size)
+	if !ok {
+		return nil, ErrorAt(-1, "symbol table runs past the end of the file")
+	}
+	if int64(symtab_sec_hdr.Sh_link) >= int64(len(f.Shdrs)) {
+		return nil, ErrorAt(-1, "symbol table string table %d is out of range",
+			symtab_sec_hdr.Sh_link)
+	}
+	strtab_sec_hdr := f.Shdrs[symtab_sec_hdr.Sh_link]
+	strtab_slice, ok := sliceAt(f.Body, strtab_sec_hdr.Sh_offset,
+		strtab_sec_hdr.Sh_size)
+	if !ok {
+		return nil, ErrorAt(-1, "symbol string table runs past the end of "+
+			"the file")
+	}
+	shndx_slice, err := f.symtabShndx(st_index)
+	if err != nil {
+		return nil, err
+	}
+	byte_reader := bytes.NewReader(symtab_slice)
+	byte_order := ToByteOrder(f.Header.Data)
+	var reader_func func(io.Reader, binary.ByteOrder, []byte) (
+		SymbolTableEntry, error)
+	sizeof_struct := 0
+	if f.Header.Class == elf.ELFCLASS32 {
+		reader_func = readSymbolEntry32
+		sizeof_struct = 16
+	} else if f.Header.Class == elf.ELFCLASS64 {
+		reader_func = readSymbolEntry64
+		sizeof_struct = 24
+	} else {
+		return nil, ErrorAt(4, "unknown ELF class %d", f.Header.Class)
+	}
+	result := make([]SymbolTableEntry, 0,
+		symtab_sec_hdr.Sh_size / uint64(sizeof_struct))
+	for {
+		new_st_entry, err := reader_func(byte_reader, byte_order, strtab_slice)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && new_st_entry.St_shndx == elf.SHN_XINDEX {
+			err = readXshndx(&new_st_entry, shndx_slice, len(result),
+				byte_order)
+		}
+		if shndx, ok := new_st_entry.Section(); err == nil && ok &&
+			shndx >= len(f.Shdrs) {
+			err = fmt.Errorf("section index %d is out of range", shndx)
+		}
+		if err != nil {
+			return nil, ErrorAt(int64(symtab_sec_hdr.Sh_offset)+
+				int64(len(result)*sizeof_struct), "symbol %d: %s",
+				len(result), err)
+		}
+		result = append(result, new_st_entry)
+	}
+	return result, nil
+}
+
+// The contents of the SHT_SYMTAB_SHNDX section for the symbol table
+// st_index, which has the section indices of the SHN_XINDEX symbols
+// (nil if there isn't one).
+func (f ElfFile) symtabShndx(st_index int) ([]byte, error) {
+	for i := range f.Shdrs {
+		shdr := &f.Shdrs[i]
+		if shdr.Sh_type != elf.SHT_SYMTAB_SHNDX ||
+			int(shdr.Sh_link) != st_index {
+			continue
+		}
+		slice, ok := sliceAt(f.Body, shdr.Sh_offset, shdr.Sh_size)
+		if !ok {
+			return nil, ErrorAt(-1, "symbol section index table runs past "+
+				"the end of the file")
+		}
+		return slice, nil
+	}
+	return nil, nil
+}
+
+// Fill in St_xshndx for the SHN_XINDEX symbol st_entry, which is
+// symbol sym_index, from the SHT_SYMTAB_SHNDX contents.
+func readXshndx(st_entry *SymbolTableEntry, shndx_slice []byte,
+	sym_index int, bo binary.ByteOrder) error {
+	if shndx_slice == nil {
+		return errors.New("section index is SHN_XINDEX, but there is no " +
+			"SHT_SYMTAB_SHNDX section")
+	}
+	entry, ok := sliceAt(shndx_slice, uint64(sym_index)*4, 4)
+	if !ok {
+		return errors.New("section index is SHN_XINDEX, but it is past " +
+			"the end of the SHT_SYMTAB_SHNDX section")
+	}
+	st_entry.St_xshndx = bo.Uint32(entry)
+	return nil
+}
+
+func GetSymBind(i uint8) elf.SymBind {
+	return elf.SymBind(i >> 4)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Read the relocation sections of an ELF file.
+
+package elffile
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// A relocation entry, normalized from Elf32Rel or Elf64Rela.
+type Relocation struct {
+	Offset uint64 // Offset of the place to patch, within the target section.
+	Sym    uint32
+	Type   uint32
+	// Only meaningful for RELA. For REL, the addend is stored at the place
+	// to be patched, and each machine knows how to extract it.
+	Addend    int64
+	HasAddend bool
+}
+
+// Reads the entries of a SHT_REL or SHT_RELA section. Errors are
+// *InputErrors, e.g., for relocations against symbols which don't exist.
+func (f *ElfFile) ReadRelocations(shndx int) ([]Relocation, error) {
+	sec_hdr := f.Shdrs[shndx]
+	results := []Relocation{}
+	// The sizes of the relocation and symbol table entries.
+	var rel_size, sym_size int64
+	switch {
+	case sec_hdr.Sh_type == elf.SHT_REL && f.Header.Class == elf.ELFCLASS32:
+		rels, err := f.ReadRel32(shndx)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range rels {
+			results = append(results, Relocation{
+				Offset: uint64(rel.R_off),
+				Sym:    Elf32_r_sym(rel.R_info),
+				Type:   uint32(Elf32_r_type(rel.R_info))})
+		}
+		rel_size, sym_size = 8, 16
+	case sec_hdr.Sh_type == elf.SHT_RELA && f.Header.Class == elf.ELFCLASS64:
+		relas, err := f.ReadRela64(shndx)
+		if err != nil {
+			return nil, err
+		}
+		for _, rela := range relas {
+			results = append(results, Relocation{
+				Offset:    rela.R_off,
+				Sym:       Elf64_r_sym(rela.R_info),
+				Type:      Elf64_r_type(rela.R_info),
+				Addend:    rela.R_addend,
+				HasAddend: true})
+		}
+		rel_size, sym_size = 24, 24
+	default:
+		return nil, ErrorAt(-1, "unsupported relocation section %s (%s) "+
+			"for %s", sec_hdr.Sh_name, sec_hdr.Sh_type, f.Header.Class)
+	}
+	// The symbol indices are looked up in the symbols from ReadSymbols,
+	// so the relocations must be for that symbol table. The section
+	// headers were checked by ReadSectionHeaders, so the relocated
+	// section exists.
+	st_index := f.symtabIndex()
+	if st_index == -1 || int64(sec_hdr.Sh_link) != int64(st_index) {
+		return nil, ErrorAt(-1, "relocation section %s is not for the "+
+			"symbol table (linked section %d)", sec_hdr.Sh_name,
+			sec_hdr.Sh_link)
+	}
+	num_syms := f.Shdrs[st_index].Sh_size / uint64(sym_size)
+	target_hdr := &f.Shdrs[sec_hdr.Sh_info]
+	for i := range results {
+		rel := &results[i]
+		var err error
+		switch {
+		case uint64(rel.Sym) >= num_syms:
+			err = fmt.Errorf("symbol index %d is out of range", rel.Sym)
+		case target_hdr.Sh_type == elf.SHT_NOBITS:
+			err = fmt.Errorf("section %s has no contents to relocate",
+				target_hdr.Sh_name)
+		case rel.Offset >= target_hdr.Sh_size:
+			err = fmt.Errorf("offset 0x%x is past the end of section %s",
+				rel.Offset, target_hdr.Sh_name)
+		case relocationSize(f.Header.Machine, rel.Type) >
+			target_hdr.Sh_size-rel.Offset:
+			err = fmt.Errorf("%d-byte place at offset 0x%x runs past the "+
+				"end of section %s", relocationSize(f.Header.Machine,
+				rel.Type), rel.Offset, target_hdr.Sh_name)
+		}
+		if err != nil {
+			return nil, ErrorAt(int64(sec_hdr.Sh_offset)+int64(i)*rel_size,
+				"relocation %d of %s: %s", i, sec_hdr.Sh_name, err)
+		}
+	}
+	return results, nil
+}
+
+// Read all the relocation sections of the file, so that bad ones are
+// reported when the file is read instead of in the middle of the link.
+func (f *ElfFile) CheckRelocations() error {
+	for j := range f.Shdrs {
+		if IsRelocSection(&f.Shdrs[j]) {
+			if _, err := f.ReadRelocations(j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The number of bytes at the place of a relocation which are read or
+// patched. Types which aren't applied are given the usual word size
+// (and R_*_NONE patches nothing, but its offset is still checked).
+func relocationSize(machine elf.Machine, typ uint32) uint64 {
+	switch machine {
+	case elf.EM_386:
+		switch elf.R_386(typ) {
+		case elf.R_386_NONE:
+			return 1
+		case elf.R_386_16, elf.R_386_PC16:
+			return 2
+		case elf.R_386_8, elf.R_386_PC8:
+			return 1
+		}
+		return 4
+	case elf.EM_X86_64:
+		switch elf.R_X86_64(typ) {
+		case elf.R_X86_64_NONE:
+			return 1
+		case elf.R_X86_64_64, elf.R_X86_64_PC64, elf.R_X86_64_GOTOFF64,
+			elf.R_X86_64_GOTPC64, elf.R_X86_64_GOT64,
+			elf.R_X86_64_GOTPCREL64, elf.R_X86_64_GOTPLT64,
+			elf.R_X86_64_PLTOFF64, elf.R_X86_64_SIZE64,
+			elf.R_X86_64_GLOB_DAT, elf.R_X86_64_JMP_SLOT,
+			elf.R_X86_64_RELATIVE, elf.R_X86_64_DTPMOD64,
+			elf.R_X86_64_DTPOFF64, elf.R_X86_64_TPOFF64:
+			return 8
+		case elf.R_X86_64_16, elf.R_X86_64_PC16:
+			return 2
+		case elf.R_X86_64_8, elf.R_X86_64_PC8:
+			return 1
+		}
+		return 4
+	case elf.EM_ARM:
+		switch elf.R_ARM(typ) {
+		case elf.R_ARM_NONE:
+			return 1
+		case elf.R_ARM_ABS16:
+			return 2
+		case elf.R_ARM_ABS8:
+			return 1
+		}
+		return 4
+	case elf.EM_MIPS:
+		switch elf.R_MIPS(typ) {
+		case elf.R_MIPS_NONE:
+			return 1
+		case elf.R_MIPS_16:
+			return 2
+		case elf.R_MIPS_64:
+			return 8
+		}
+		return 4
+	}
+	return 1
+}
+
+func IsRelocSection(shdr *SectionHeader) bool {
+	return shdr.Sh_type == elf.SHT_REL || shdr.Sh_type == elf.SHT_RELA
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Methods for testing with well-formed test files (copies of the
+// internal/testutil/elftest ones, which import this package).
+
+package elffile
+
+import (
+	"os"
+)
+
+// Read an ELF test file, which should be well-formed (panics otherwise).
+func ReadElfFileFname(fname string) ElfFile {
+	f, err := os.Open(fname)
+	if err != nil {
+		panic("Failed to open file: " + string(fname) +
+			" error: " + err.Error())
+	}
+	defer f.Close()
+	elf_file, err := ReadElfFileFD(f)
+	if err != nil {
+		panic(InFile(err, fname))
+	}
+	return elf_file
+}
+
+// Read the symbols of a test file, which should be well-formed
+// (panics otherwise, like ReadElfFileFname).
+func ReadSymbolsForTest(f ElfFile) SymbolTable {
+	st, err := f.ReadSymbols()
+	if err != nil {
+		panic(err)
+	}
+	return st
+}
+
+// Read an ELF file from a buffer, which should be well-formed.
+func ReadElfFileForTest(buf []byte) ElfFile {
+	elf_file, err := ReadElfFile(buf)
+	if err != nil {
+		panic(err)
+	}
+	return elf_file
+}
+
+// The index of the section with the given name, which the test file
+// should have.
+func FindSectionIndexForTest(name string, f *ElfFile) int {
+	for i := range f.Shdrs {
+		if f.Shdrs[i].Sh_name == name {
+			return i
+		}
+	}
+	panic("Cannot find section w/ name: " + name)
+}
@@ -1,100 +1,37 @@
 // Copyright (c) 2013, Jan Voung
 // All rights reserved.
 
-// Driver for go-ld.
+// Driver for go-ld. The linking itself is done by the driver package;
+// this only parses the command line and reports the result.
 
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"os"
-)
-
-// This only handles .o files for now. For .a files, we'd need
-// to have a list of SymbolTables (one for each archive member).
-type read_symbols_result struct {
-	fname string
-	elf   ElfFile
-	st    SymbolTable
-}
 
-func read_symbols_task(fname string, ftyp FileType,
-	fhandles map[string]*os.File,
-	done_ch chan read_symbols_result) {
-	fhandle := fhandles[fname]
-	switch ftyp {
-	case ELF_FILE:
-		elf_file := ReadElfFileFD(fhandle)
-		st := elf_file.ReadSymbols()
-		done_ch <- read_symbols_result{fname, elf_file, st}
-	case AR_FILE, THIN_AR_FILE:
-		panic("Not handling archives for now")
-	default:
-		panic("Unknown file type")
-	}
-}
+	"github.com/jvoung/go-ld/driver"
+)
 
 func main() {
-	flag.Parse()
-	fmt.Printf("Writing to: %s\n", Outfile)
-	fmt.Printf("With entry point func: %s\n", EntryPointFunc)
-	fmt.Printf("Search Paths to: %s\n", SearchPaths)
-	inputs := flag.Args()
-	fmt.Println("Other inputs:", inputs)
-
-	// Go through search-paths to figure out the actual filenames of libs too.
-	// Other non-library inputs aren't found in the library paths.
-	lib_full_paths := DetermineFilepaths(LibraryFiles, SearchPaths)
-	full_paths := append(inputs, lib_full_paths...)
-	fmt.Printf("Full paths of inputs and libs: %v\n", full_paths)
-
-	// Open the files.
-	fhandles := make(map[string]*os.File, len(full_paths))
-	for _, fname := range full_paths {
-		f, err := os.Open(fname)
-		if err != nil {
-			fmt.Print("Failed to open file:", fname, "error:", err)
-			return
+	c := ParseArgs()
+	config := c.Config()
+	config.Log = os.Stdout
+	result, err := driver.Link(context.Background(), config)
+	if err != nil {
+		var link_err *driver.LinkError
+		if errors.As(err, &link_err) {
+			for _, e := range link_err.Errors {
+				fmt.Fprintln(os.Stderr, "Error:", e)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", err)
 		}
-		defer f.Close()
-		fhandles[fname] = f
+		os.Exit(1)
 	}
-
-	// Validate that the inputs are really ELF or .a files
-	// full of ELF.
-	file_map := ValidateFiles(fhandles)
-	fmt.Println("File types: ", file_map)
-
-	// Map the files (index) -> symbol tables.
-	// Only handle .o files for now.
-	f_symbols := make([]SymbolTable, len(fhandles))
-
-	// Remember the elf files too (section headers, etc.)
-	elf_files := make([]ElfFile, len(fhandles))
-
-	// Channel for reading them in parallel.
-	read_symbols := make(chan read_symbols_result, len(fhandles))
-	for fname, ftyp := range file_map {
-		go read_symbols_task(fname, ftyp, fhandles, read_symbols)
-	}
-	for i := 0; i < len(file_map); i++ {
-		result := <-read_symbols
-		f_symbols[i] = result.st
-		elf_files[i] = result.elf
+	for _, warning := range result.Warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
 	}
-	fmt.Println("file symbols: ", f_symbols)
-
-	// Resolve symbols to determine which files to pull in.
-	resolved_sym_info := ResolveSymbols(f_symbols)
-	fmt.Println("resolved symbol info: ", resolved_sym_info)
-
-	// Pull in the files, and lay them out, adjusting the symbol table values
-	// from offsets to absolute addresses.
-	// All files are needed, assuming no archives.
-	DoLayout(f_symbols, elf_files)
-
-	// Fix up the relocations based on the layout.
-
-	// Write out the file.
 }
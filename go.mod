@@ -0,0 +1,3 @@
+module github.com/jvoung/go-ld
+
+go 1.21
@@ -0,0 +1,58 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Methods for testing with well-formed ELF test files, shared by the
+// tests of the packages above elffile (elffile's own tests can't import
+// this, so they have copies).
+
+package elftest
+
+import (
+	"os"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+// Read an ELF test file, which should be well-formed (panics otherwise).
+func ReadElfFileFname(fname string) elffile.ElfFile {
+	f, err := os.Open(fname)
+	if err != nil {
+		panic("Failed to open file: " + string(fname) +
+			" error: " + err.Error())
+	}
+	defer f.Close()
+	elf_file, err := elffile.ReadElfFileFD(f)
+	if err != nil {
+		panic(elffile.InFile(err, fname))
+	}
+	return elf_file
+}
+
+// Read the symbols of a test file, which should be well-formed.
+func ReadSymbolsForTest(f elffile.ElfFile) elffile.SymbolTable {
+	st, err := f.ReadSymbols()
+	if err != nil {
+		panic(err)
+	}
+	return st
+}
+
+// Read an ELF file from a buffer, which should be well-formed.
+func ReadElfFileForTest(buf []byte) elffile.ElfFile {
+	elf_file, err := elffile.ReadElfFile(buf)
+	if err != nil {
+		panic(err)
+	}
+	return elf_file
+}
+
+// The index of the section with the given name, which the test file
+// should have.
+func FindSectionIndexForTest(name string, f *elffile.ElfFile) int {
+	for i := range f.Shdrs {
+		if f.Shdrs[i].Sh_name == name {
+			return i
+		}
+	}
+	panic("Cannot find section w/ name: " + name)
+}
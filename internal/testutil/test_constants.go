@@ -0,0 +1,36 @@
+// Copyright (c) 2013, Jan Voung
+// All rights reserved.
+
+// Filename / directory constants to testing
+
+package testutil
+
+import (
+	"path"
+	"runtime"
+)
+
+// The test_binaries directory at the top of the repository, which the
+// tests of each package use (from their own directories).
+var TestBaseDir = testBaseDir()
+
+func testBaseDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Join(path.Dir(file), "..", "..", "test_binaries")
+}
+
+func TestX8632BaseDir() string {
+	return path.Join(TestBaseDir, "i686")
+}
+func TestX8664BaseDir() string {
+	return path.Join(TestBaseDir, "x86_64")
+}
+func TestARMBaseDir() string {
+	return path.Join(TestBaseDir, "arm")
+}
+func TestMIPSBaseDir() string {
+	return path.Join(TestBaseDir, "mips")
+}
+func TestLibDir() string {
+	return path.Join(TestBaseDir, "test_libdir")
+}
@@ -1,11 +1,14 @@
 // Copyright (c) 2014, Jan Voung
 // All rights reserved.
 
-// More methods for testing.
+// More methods for testing, shared by the tests of each package.
 
-package main
+package testutil
 
 import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
 	"runtime"
 	"testing"
 )
@@ -53,3 +56,39 @@ func AssertEqM(t *testing.T, v1, v2 interface{}, s string) {
 		}
 	}
 }
+
+func AssertNoError(t *testing.T, err error) {
+	if err != nil {
+		_, file, line, ok := runtime.Caller(1)
+		if ok {
+			t.Fatalf("(%s:%d) Unexpected error: %s", file, line, err)
+		} else {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+}
+
+func WriteFileForTest(t *testing.T, fname string, contents string) {
+	if err := ioutil.WriteFile(fname, []byte(contents), 0644); err != nil {
+		t.Fatal("Failed to write", fname, err)
+	}
+}
+
+// Add the test binaries matching the pattern (in each machine's
+// directory) to the seed corpus of a fuzz target.
+func AddFuzzSeeds(f *testing.F, pattern string) {
+	for _, dir := range []string{TestX8632BaseDir(), TestX8664BaseDir(),
+		TestARMBaseDir(), TestMIPSBaseDir(), TestLibDir()} {
+		fnames, err := filepath.Glob(path.Join(dir, pattern))
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, fname := range fnames {
+			buf, err := ioutil.ReadFile(fname)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(buf)
+		}
+	}
+}
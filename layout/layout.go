@@ -0,0 +1,826 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Lay out the linked files into segments, and adjust the symbol table
+// with the new addresses.
+
+package layout
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jvoung/go-ld/elffile"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+// Default layout order for PHDRs.
+// The segment to sections map from readelf also shows that
+// although the .note.* are part of the .rodata, they have
+// their own segment (of type NOTE) instead.
+// Same with .eh_frame_hdr, which is R only, but is its own
+// segment of type GNU_EH_FRAME.
+var phdr_order = [][]string{{".text"}, // R+E
+	{".note", ".rodata", ".reginfo", ".eh_frame_hdr"}, // R
+	{".data", ".eh_frame", ".got", ".bss"}}            // R + W
+
+// Indices into phdr_order.
+const (
+	textSegment   = 0
+	rodataSegment = 1
+	dataSegment   = 2
+)
+
+var segmentFlags = []elf.ProgFlag{elf.PF_R | elf.PF_X, elf.PF_R,
+	elf.PF_R | elf.PF_W}
+
+// Where a (non-sandboxed) static executable is loaded for each machine,
+// and the maximum page size, matching the GNU ld defaults.
+type machineLayout struct {
+	BaseAddr uint64
+	PageSize uint64
+}
+
+var machineLayouts = map[elf.Machine]machineLayout{
+	elf.EM_386:    {0x8048000, 0x1000},
+	elf.EM_X86_64: {0x400000, 0x1000},
+	elf.EM_ARM:    {0x10000, 0x10000},
+	elf.EM_MIPS:   {0x400000, 0x10000},
+}
+
+// How the segments are arranged.
+type LayoutMode int
+
+const (
+	// A plain static executable, like GNU ld -static. The headers and
+	// text come first, then the rodata and data segments.
+	StandardLayout LayoutMode = iota
+	// The NaCl sandbox layout, like gold -m elf_nacl. The text is at
+	// 0x20000 (file offset 0x10000), and the rodata segment (which maps
+	// the headers) is at 0x10020000, followed by the data segment.
+	NaClLayout
+)
+
+type LayoutOptions struct {
+	Mode LayoutMode
+	// Create an .eh_frame_hdr and a PT_GNU_EH_FRAME for the .eh_frame.
+	// The .eh_frame_hdr has no search table, so unwinders will fall back
+	// to a linear search of the .eh_frame.
+	EhFrameHdr bool
+	// The names of the input files (e.g., archive(member)), for errors.
+	ObjectNames []string
+}
+
+// Pick the layout mode from the -m emulation name (e.g., elf_nacl or
+// armelf_nacl).
+func LayoutModeForEmulation(emulation string) LayoutMode {
+	if strings.HasSuffix(emulation, "_nacl") {
+		return NaClLayout
+	}
+	return StandardLayout
+}
+
+const (
+	naclTextAddr   = 0x20000
+	naclTextOffset = 0x10000
+	naclRodataAddr = 0x10020000
+	naclPageSize   = 0x10000
+	naclBundleSize = 32
+)
+
+// Parts of the NaCl layout which depend on the machine.
+type naclMachineLayout struct {
+	// Alignment of the start of the data segment.
+	DataAlign uint64
+	// Fills the gaps in the text segment (x86 uses hlt).
+	TextFill byte
+}
+
+var naclLayouts = map[elf.Machine]naclMachineLayout{
+	elf.EM_386:    {32, 0xf4},
+	elf.EM_X86_64: {32, 0xf4},
+	elf.EM_ARM:    {8, 0},
+	elf.EM_MIPS:   {8, 0},
+}
+
+// Input sections named <prefix> or <prefix>.* are merged into the
+// output section <prefix>. Other sections are only merged with
+// sections of the exact same name.
+var mergedSectionPrefixes = []string{".text", ".rodata", ".data", ".bss",
+	".sdata", ".sbss", ".ARM.exidx", ".ARM.extab"}
+
+// The result of DoLayout.
+type Layout struct {
+	File elffile.ElfFile
+	// Where each input section ended up.
+	Sections InputSectionMap
+	// The .got, already placed. The slots are filled after relocation.
+	GOT *GOT
+	// Symbols defined by the linker (see RelocContext.LinkerSyms).
+	LinkerSyms map[string]uint64
+}
+
+// An input section and its offset within the output section.
+type inputSection struct {
+	file   int
+	shndx  int
+	offset uint64
+}
+
+type outputSection struct {
+	shdr elffile.SectionHeader
+	// Where it goes: the phdr_order segment, and rank within the segment.
+	segment int
+	rank    int
+	// Order of first appearance, to break ties.
+	order  int
+	inputs []inputSection
+	// Contents of a section made by the linker (e.g., .reginfo).
+	contents []byte
+}
+
+func alignUp(v uint64, align uint64) uint64 {
+	if align <= 1 {
+		return v
+	}
+	return (v + align - 1) / align * align
+}
+
+func hasSectionPrefix(name string, prefix string) bool {
+	return name == prefix || strings.HasPrefix(name, prefix+".")
+}
+
+func outputSectionName(name string) string {
+	for _, prefix := range mergedSectionPrefixes {
+		if hasSectionPrefix(name, prefix) {
+			return prefix
+		}
+	}
+	return name
+}
+
+// Which segment of phdr_order the output section belongs in, and its
+// rank within the segment. Sections not listed in phdr_order go after
+// the listed ones, in a segment chosen by their flags.
+func segmentOf(name string, flags elf.SectionFlag) (int, int) {
+	for seg, names := range phdr_order {
+		for rank, prefix := range names {
+			if hasSectionPrefix(name, prefix) {
+				return seg, rank
+			}
+		}
+	}
+	seg := rodataSegment
+	if flags&elf.SHF_EXECINSTR != 0 {
+		seg = textSegment
+	} else if flags&elf.SHF_WRITE != 0 {
+		seg = dataSegment
+	}
+	return seg, len(phdr_order[seg])
+}
+
+func newOutputSection(name string, typ elf.SectionType,
+	flags elf.SectionFlag, order int) *outputSection {
+	seg, rank := segmentOf(name, flags)
+	return &outputSection{
+		shdr: elffile.SectionHeader{Sh_name: name, Sh_type: typ,
+			Sh_addralign: 1},
+		segment: seg, rank: rank, order: order}
+}
+
+// Append the input section at the given alignment (at least the
+// input's own Sh_addralign).
+func (s *outputSection) addInput(file int, shndx int, in *elffile.SectionHeader,
+	align uint64) {
+	offset := alignUp(s.shdr.Sh_size, align)
+	s.inputs = append(s.inputs, inputSection{file, shndx, offset})
+	s.shdr.Sh_size = offset + in.Sh_size
+	if align > s.shdr.Sh_addralign {
+		s.shdr.Sh_addralign = align
+	}
+	// Merging of strings/constants isn't done, and groups are resolved.
+	s.shdr.Sh_flags |= in.Sh_flags &^ (elf.SHF_GROUP | elf.SHF_MERGE |
+		elf.SHF_STRINGS | elf.SHF_INFO_LINK)
+}
+
+func (s *outputSection) isNobits() bool {
+	return s.shdr.Sh_type == elf.SHT_NOBITS
+}
+
+// Whether the input section is copied to the output. The .reginfo
+// sections are not copied, but merged into one by the linker.
+func isLoadedInputSection(shdr *elffile.SectionHeader) bool {
+	return shdr.Sh_flags&elf.SHF_ALLOC != 0 &&
+		shdr.Sh_type != elf.SHT_GROUP &&
+		shdr.Sh_type != SHT_MIPS_REGINFO
+}
+
+// Find the members of COMDAT groups whose signature was already seen
+// in an earlier file. Only the first copy of a group is kept.
+func discardedComdatSections(files []elffile.ElfFile, f_syms []elffile.SymbolTable) [][]bool {
+	seen := make(map[string]bool)
+	result := make([][]bool, len(files))
+	for i := range files {
+		result[i] = make([]bool, len(files[i].Shdrs))
+		for _, group := range elffile.ComdatGroups(&files[i], f_syms[i]) {
+			if !seen[group.Signature] {
+				seen[group.Signature] = true
+				continue
+			}
+			for _, member := range group.Members {
+				result[i][member] = true
+			}
+		}
+	}
+	return result
+}
+
+// Rewrite symbol values from section offsets to absolute addresses.
+// Global symbols defined in a discarded COMDAT group take the address
+// of the copy that was kept.
+func relocateSymbols(f_syms []elffile.SymbolTable, sections InputSectionMap,
+	discarded [][]bool) {
+	kept := make(map[string]uint64)
+	for i := range f_syms {
+		for k := range f_syms[i] {
+			st_entry := &f_syms[i][k]
+			shndx, ok := st_entry.Section()
+			if !ok || !sections.IsPlaced(i, shndx) {
+				continue
+			}
+			st_entry.St_value += sections[i][shndx].Addr
+			if elffile.St_bind(st_entry.St_info) == elf.STB_LOCAL {
+				continue
+			}
+			if _, ok := kept[st_entry.St_name]; !ok {
+				kept[st_entry.St_name] = st_entry.St_value
+			}
+		}
+	}
+	for i := range f_syms {
+		for k := range f_syms[i] {
+			st_entry := &f_syms[i][k]
+			shndx, ok := st_entry.Section()
+			if !ok || shndx >= len(discarded[i]) || !discarded[i][shndx] ||
+				elffile.St_bind(st_entry.St_info) == elf.STB_LOCAL {
+				continue
+			}
+			if addr, ok := kept[st_entry.St_name]; ok {
+				st_entry.St_value = addr
+			}
+		}
+	}
+}
+
+// A COMMON symbol to allocate in .bss: the one chosen as the definition
+// of its name (see ResolveSymbols), with the largest size and strictest
+// alignment of all the COMMON symbols of that name.
+type commonSymbol struct {
+	def    SymRef
+	size   uint64
+	align  uint64
+	offset uint64 // Offset in .bss.
+}
+
+// Merge the COMMON symbols by name, in order of first appearance.
+// COMMON symbols overridden by a real definition take no space.
+func mergeCommonSymbols(f_syms []elffile.SymbolTable,
+	link_info []resolver.SymLinkInfo) []*commonSymbol {
+	by_def := make(map[SymRef]*commonSymbol)
+	result := []*commonSymbol{}
+	for i := range f_syms {
+		for k := range f_syms[i] {
+			st_entry := &f_syms[i][k]
+			if st_entry.St_shndx != elf.SHN_COMMON {
+				continue
+			}
+			def := SymRef{i, uint32(k)}
+			if r, ok := link_info[i].OverriddenSyms[k]; ok {
+				def = SymRef{r.DefFileIndex, uint32(r.DefSymIndex)}
+			}
+			if f_syms[def.File][def.Sym].St_shndx != elf.SHN_COMMON {
+				continue
+			}
+			c, ok := by_def[def]
+			if !ok {
+				c = &commonSymbol{def: def, align: 1}
+				by_def[def] = c
+				result = append(result, c)
+			}
+			// For COMMON symbols, St_value is the alignment.
+			if st_entry.St_size > c.size {
+				c.size = st_entry.St_size
+			}
+			if st_entry.St_value > c.align {
+				c.align = st_entry.St_value
+			}
+		}
+	}
+	return result
+}
+
+// Append a string to a string table, returning its index.
+func addString(strtab *[]byte, s string) uint32 {
+	index := uint32(len(*strtab))
+	*strtab = append(append(*strtab, s...), 0)
+	return index
+}
+
+func elfHeaderSizes(class elf.Class) (uint16, uint16, uint16) {
+	if class == elf.ELFCLASS64 {
+		return 64, 56, 64
+	}
+	return 52, 32, 40
+}
+
+// Assign addresses and file offsets to the sections of segment seg,
+// starting at start bytes into the segment. P_offset and P_vaddr must
+// already be set. Returns the file offset past the last section with
+// contents.
+func placeSegment(phdr *elffile.ProgramHeader, seg int,
+	out_sections []*outputSection, start uint64) uint64 {
+	file_off := phdr.P_offset + start
+	vaddr := phdr.P_vaddr + start
+	for _, s := range out_sections {
+		if s.segment != seg {
+			continue
+		}
+		vaddr = alignUp(vaddr, s.shdr.Sh_addralign)
+		s.shdr.Sh_addr = vaddr
+		if s.isNobits() {
+			s.shdr.Sh_offset = file_off
+		} else {
+			s.shdr.Sh_offset = phdr.P_offset + (vaddr - phdr.P_vaddr)
+			file_off = s.shdr.Sh_offset + s.shdr.Sh_size
+		}
+		vaddr += s.shdr.Sh_size
+	}
+	phdr.P_filesz = file_off - phdr.P_offset
+	phdr.P_memsz = vaddr - phdr.P_vaddr
+	return file_off
+}
+
+// The file and program headers are mapped at the start of the text
+// segment. Each following segment starts on a new page, at an address
+// congruent to its file offset. Returns the end of the loaded part
+// of the file.
+func placeStandard(phdrs []elffile.ProgramHeader, out_sections []*outputSection,
+	machine machineLayout, headers_size uint64) uint64 {
+	text := &phdrs[textSegment]
+	text.P_offset = 0
+	text.P_vaddr = machine.BaseAddr
+	file_off := placeSegment(text, textSegment, out_sections, headers_size)
+	prev := text
+	for _, seg := range []int{rodataSegment, dataSegment} {
+		phdr := &phdrs[seg]
+		phdr.P_offset = file_off
+		phdr.P_vaddr = alignUp(prev.P_vaddr+prev.P_memsz, machine.PageSize) +
+			file_off%machine.PageSize
+		file_off = placeSegment(phdr, seg, out_sections, 0)
+		prev = phdr
+	}
+	return file_off
+}
+
+// The rodata segment maps the headers from file offset 0, and the data
+// segment follows it in the file (and a page later in memory). The text
+// segment comes after those in the file, but is mapped below them.
+func placeNaCl(phdrs []elffile.ProgramHeader, out_sections []*outputSection,
+	nacl naclMachineLayout, headers_size uint64) uint64 {
+	rodata := &phdrs[rodataSegment]
+	rodata.P_offset = 0
+	rodata.P_vaddr = naclRodataAddr
+	file_off := placeSegment(rodata, rodataSegment, out_sections, headers_size)
+	data := &phdrs[dataSegment]
+	data.P_offset = alignUp(file_off, nacl.DataAlign)
+	data.P_vaddr = rodata.P_vaddr + naclPageSize + data.P_offset
+	file_off = placeSegment(data, dataSegment, out_sections, 0)
+	text := &phdrs[textSegment]
+	text.P_offset = alignUp(file_off, naclPageSize)
+	if text.P_offset < naclTextOffset {
+		text.P_offset = naclTextOffset
+	}
+	text.P_vaddr = naclTextAddr
+	return placeSegment(text, textSegment, out_sections, 0)
+}
+
+// Make the (non-loaded) program header cover the given sections.
+func coverSections(phdr *elffile.ProgramHeader, first *elffile.SectionHeader,
+	last *elffile.SectionHeader) {
+	phdr.P_offset = first.Sh_offset
+	phdr.P_vaddr = first.Sh_addr
+	phdr.P_paddr = first.Sh_addr
+	phdr.P_filesz = last.Sh_offset + last.Sh_size - first.Sh_offset
+	phdr.P_memsz = phdr.P_filesz
+	phdr.P_align = first.Sh_addralign
+}
+
+// DWARF pointer encodings used in the .eh_frame_hdr.
+const (
+	DW_EH_PE_sdata4 = 0x0b
+	DW_EH_PE_pcrel  = 0x10
+	DW_EH_PE_omit   = 0xff
+	ehFrameHdrSize  = 8
+)
+
+// An .eh_frame_hdr with only the pointer to the .eh_frame
+// (the FDE count and table are omitted).
+func makeEhFrameHdr(hdr *elffile.SectionHeader, eh_frame *elffile.SectionHeader,
+	byte_order binary.ByteOrder) []byte {
+	result := []byte{1, DW_EH_PE_pcrel | DW_EH_PE_sdata4, DW_EH_PE_omit,
+		DW_EH_PE_omit, 0, 0, 0, 0}
+	byte_order.PutUint32(result[4:], uint32(eh_frame.Sh_addr-(hdr.Sh_addr+4)))
+	return result
+}
+
+// All the inputs are laid out and relocated for one machine, so they
+// must match the first input in class, data encoding and machine.
+func checkInputsMatch(files []elffile.ElfFile, object_names []string) error {
+	name := func(i int) string {
+		if i < len(object_names) {
+			return object_names[i]
+		}
+		return fmt.Sprintf("input %d", i)
+	}
+	first := &files[0].Header
+	for i := 1; i < len(files); i++ {
+		h := &files[i].Header
+		var offset int64
+		var err error
+		switch {
+		case h.Class != first.Class:
+			offset = 4
+			err = fmt.Errorf("ELF class %s does not match %s of %s",
+				h.Class, first.Class, name(0))
+		case h.Data != first.Data:
+			offset = 5
+			err = fmt.Errorf("ELF data encoding %s does not match %s of %s",
+				h.Data, first.Data, name(0))
+		case h.Machine != first.Machine:
+			offset = 18
+			err = fmt.Errorf("machine %s does not match %s of %s",
+				h.Machine, first.Machine, name(0))
+		default:
+			continue
+		}
+		return &elffile.InputError{File: name(i), Offset: offset, Err: err}
+	}
+	return nil
+}
+
+// Lay out the input files as a static executable. Sections of the same
+// name (see mergedSectionPrefixes) are concatenated in file order, and
+// grouped into R+X, R, and R+W segments according to phdr_order.
+// Where the segments go depends on opts.Mode.
+// The symbol values in f_syms are rewritten in place from section offsets
+// to absolute addresses, so this must only be called once. The COMMON
+// symbols which are allocated in .bss become SHN_ABS symbols.
+// Errors are for inputs which can't be laid out (none, an unsupported
+// machine, or inputs which don't match the first).
+func DoLayout(f_syms []elffile.SymbolTable, files []elffile.ElfFile,
+	link_info []resolver.SymLinkInfo, opts LayoutOptions) (Layout, error) {
+	if len(files) == 0 {
+		return Layout{}, errors.New("no input files")
+	}
+	if err := checkInputsMatch(files, opts.ObjectNames); err != nil {
+		return Layout{}, err
+	}
+	first := &files[0].Header
+	machine, ok := machineLayouts[first.Machine]
+	if !ok {
+		return Layout{}, fmt.Errorf("layout not supported for machine %s",
+			first.Machine)
+	}
+	var nacl naclMachineLayout
+	if opts.Mode == NaClLayout {
+		nacl, ok = naclLayouts[first.Machine]
+		if !ok {
+			return Layout{}, fmt.Errorf("NaCl layout not supported for "+
+				"machine %s", first.Machine)
+		}
+		machine.PageSize = naclPageSize
+	}
+
+	// Go through files in order, and figure out the output sections,
+	// concatenating each input section.
+	discarded := discardedComdatSections(files, f_syms)
+	sections := make(InputSectionMap, len(files))
+	by_name := make(map[string]*outputSection)
+	out_sections := []*outputSection{}
+	has_reginfo := false
+	has_gnu_stack := false
+	for i := range files {
+		f := &files[i]
+		sections[i] = make([]SectionPlacement, len(f.Shdrs))
+		for j := range f.Shdrs {
+			shdr := &f.Shdrs[j]
+			if shdr.Sh_type == SHT_MIPS_REGINFO {
+				has_reginfo = true
+			}
+			if shdr.Sh_name == ".note.GNU-stack" {
+				has_gnu_stack = true
+			}
+			if !isLoadedInputSection(shdr) || discarded[i][j] {
+				continue
+			}
+			name := outputSectionName(shdr.Sh_name)
+			out, ok := by_name[name]
+			if !ok {
+				out = newOutputSection(name, shdr.Sh_type, shdr.Sh_flags,
+					len(out_sections))
+				by_name[name] = out
+				out_sections = append(out_sections, out)
+			}
+			align := shdr.Sh_addralign
+			if opts.Mode == NaClLayout && out.segment == textSegment &&
+				align < naclBundleSize {
+				align = naclBundleSize
+			}
+			out.addInput(i, j, shdr, align)
+			sections[i][j].Placed = true
+		}
+	}
+	// COMMON symbols go at the end of .bss.
+	commons := mergeCommonSymbols(f_syms, link_info)
+	var bss *outputSection
+	if len(commons) > 0 {
+		bss, ok = by_name[".bss"]
+		if !ok {
+			bss = newOutputSection(".bss", elf.SHT_NOBITS,
+				elf.SHF_ALLOC|elf.SHF_WRITE, len(out_sections))
+			bss.shdr.Sh_flags = elf.SHF_ALLOC | elf.SHF_WRITE
+			by_name[".bss"] = bss
+			out_sections = append(out_sections, bss)
+		}
+		for _, c := range commons {
+			c.offset = alignUp(bss.shdr.Sh_size, c.align)
+			bss.shdr.Sh_size = c.offset + c.size
+			if c.align > bss.shdr.Sh_addralign {
+				bss.shdr.Sh_addralign = c.align
+			}
+		}
+	}
+	if opts.Mode == NaClLayout {
+		// Code must also end on a bundle boundary.
+		for _, s := range out_sections {
+			if s.segment == textSegment {
+				s.shdr.Sh_size = alignUp(s.shdr.Sh_size, naclBundleSize)
+			}
+		}
+	}
+
+	// Now that it's known which sections are kept, size the GOT.
+	got := ScanGOTRelocs(files, f_syms, link_info, sections)
+	got_sec := newOutputSection(".got", elf.SHT_PROGBITS,
+		elf.SHF_ALLOC|elf.SHF_WRITE, len(out_sections))
+	got_sec.shdr.Sh_flags = elf.SHF_ALLOC | elf.SHF_WRITE
+	got_sec.shdr.Sh_size = got.Size()
+	got_sec.shdr.Sh_addralign = got.EntSize
+	got_sec.shdr.Sh_entsize = got.EntSize
+	out_sections = append(out_sections, got_sec)
+	var reginfo_sec *outputSection
+	if has_reginfo {
+		reginfo_sec = newOutputSection(".reginfo", SHT_MIPS_REGINFO,
+			elf.SHF_ALLOC, len(out_sections))
+		reginfo_sec.shdr.Sh_flags = elf.SHF_ALLOC
+		reginfo_sec.shdr.Sh_size = mipsRegInfoSize
+		reginfo_sec.shdr.Sh_addralign = 4
+		reginfo_sec.shdr.Sh_entsize = mipsRegInfoSize
+		out_sections = append(out_sections, reginfo_sec)
+	}
+	var eh_frame_hdr_sec *outputSection
+	if _, ok := by_name[".eh_frame"]; ok && opts.EhFrameHdr {
+		eh_frame_hdr_sec = newOutputSection(".eh_frame_hdr", elf.SHT_PROGBITS,
+			elf.SHF_ALLOC, len(out_sections))
+		eh_frame_hdr_sec.shdr.Sh_flags = elf.SHF_ALLOC
+		eh_frame_hdr_sec.shdr.Sh_size = ehFrameHdrSize
+		eh_frame_hdr_sec.shdr.Sh_addralign = 4
+		out_sections = append(out_sections, eh_frame_hdr_sec)
+	}
+
+	// Within a segment, NOBITS sections go at the end so that they
+	// don't take up file space.
+	sort.SliceStable(out_sections, func(a, b int) bool {
+		sa, sb := out_sections[a], out_sections[b]
+		if sa.segment != sb.segment {
+			return sa.segment < sb.segment
+		}
+		if sa.isNobits() != sb.isNobits() {
+			return sb.isNobits()
+		}
+		if sa.rank != sb.rank {
+			return sa.rank < sb.rank
+		}
+		return sa.order < sb.order
+	})
+
+	// Figure out the program headers: one PT_LOAD per phdr_order entry,
+	// and then the non-loaded ones.
+	var note_secs []*outputSection
+	for _, s := range out_sections {
+		if s.shdr.Sh_type == elf.SHT_NOTE {
+			note_secs = append(note_secs, s)
+		}
+	}
+	phdrs := make([]elffile.ProgramHeader, len(phdr_order))
+	if len(note_secs) > 0 {
+		phdrs = append(phdrs, elffile.ProgramHeader{P_type: elf.PT_NOTE,
+			P_flags: elf.PF_R})
+	}
+	if eh_frame_hdr_sec != nil {
+		phdrs = append(phdrs, elffile.ProgramHeader{P_type: elf.PT_GNU_EH_FRAME,
+			P_flags: elf.PF_R})
+	}
+	if has_gnu_stack {
+		phdrs = append(phdrs, elffile.ProgramHeader{P_type: elf.PT_GNU_STACK,
+			P_flags: elf.PF_R | elf.PF_W, P_align: 16})
+	}
+	ehsize, phentsize, shentsize := elfHeaderSizes(first.Class)
+	headers_size := uint64(ehsize) + uint64(len(phdrs))*uint64(phentsize)
+
+	// Assign addresses and file offsets.
+	for seg := range phdr_order {
+		phdrs[seg].P_type = elf.PT_LOAD
+		phdrs[seg].P_flags = segmentFlags[seg]
+		phdrs[seg].P_align = machine.PageSize
+	}
+	var file_off uint64
+	if opts.Mode == NaClLayout {
+		file_off = placeNaCl(phdrs, out_sections, nacl, headers_size)
+	} else {
+		file_off = placeStandard(phdrs, out_sections, machine, headers_size)
+	}
+	for i := range phdrs {
+		phdr := &phdrs[i]
+		switch phdr.P_type {
+		case elf.PT_LOAD:
+			phdr.P_paddr = phdr.P_vaddr
+		case elf.PT_NOTE:
+			coverSections(phdr, &note_secs[0].shdr,
+				&note_secs[len(note_secs)-1].shdr)
+		case elf.PT_GNU_EH_FRAME:
+			coverSections(phdr, &eh_frame_hdr_sec.shdr, &eh_frame_hdr_sec.shdr)
+		}
+	}
+
+	// Record where each input section went, and fix up the symbols.
+	for _, s := range out_sections {
+		for _, in := range s.inputs {
+			sections[in.file][in.shndx].Addr = s.shdr.Sh_addr + in.offset
+			sections[in.file][in.shndx].Offset = s.shdr.Sh_offset + in.offset
+		}
+	}
+	relocateSymbols(f_syms, sections, discarded)
+	// The allocated COMMON symbols become absolute symbols in .bss.
+	for _, c := range commons {
+		st_entry := &f_syms[c.def.File][c.def.Sym]
+		st_entry.St_value = bss.shdr.Sh_addr + c.offset
+		st_entry.St_size = c.size
+		st_entry.St_shndx = elf.SHN_ABS
+	}
+	got.Addr = got_sec.shdr.Sh_addr
+	got.Offset = got_sec.shdr.Sh_offset
+
+	text := &phdrs[textSegment]
+	data := &phdrs[dataSegment]
+	linker_syms := map[string]uint64{
+		"_GLOBAL_OFFSET_TABLE_": got.Addr,
+		"__executable_start":    text.P_vaddr,
+		"_etext":                text.P_vaddr + text.P_memsz,
+		"etext":                 text.P_vaddr + text.P_memsz,
+		"_edata":                data.P_vaddr + data.P_filesz,
+		"edata":                 data.P_vaddr + data.P_filesz,
+		"__bss_start":           data.P_vaddr + data.P_filesz,
+		"_end":                  data.P_vaddr + data.P_memsz,
+		"end":                   data.P_vaddr + data.P_memsz,
+	}
+	if first.Machine == elf.EM_MIPS {
+		linker_syms["_gp"] = got.Addr + MIPSGPOffset
+	}
+	if exidx, ok := by_name[".ARM.exidx"]; ok {
+		linker_syms["__exidx_start"] = exidx.shdr.Sh_addr
+		linker_syms["__exidx_end"] = exidx.shdr.Sh_addr + exidx.shdr.Sh_size
+	}
+	if reginfo_sec != nil {
+		reginfo_sec.contents = MergeMIPSRegInfo(files, linker_syms["_gp"])
+	}
+	if eh_frame_hdr_sec != nil {
+		eh_frame_hdr_sec.contents = makeEhFrameHdr(&eh_frame_hdr_sec.shdr,
+			&by_name[".eh_frame"].shdr, elffile.ToByteOrder(first.Data))
+	}
+
+	// Copy the section contents to the result body. The headers and
+	// the non-loaded sections (only .shstrtab) go around them.
+	shstrtab := []byte{0}
+	shdrs := []elffile.SectionHeader{{}}
+	text_shndx := uint32(0)
+	for _, s := range out_sections {
+		if s == got_sec && got.Size() == 0 {
+			continue
+		}
+		s.shdr.Sh_name_index = addString(&shstrtab, s.shdr.Sh_name)
+		if s.shdr.Sh_name == ".text" {
+			text_shndx = uint32(len(shdrs))
+		}
+		shdrs = append(shdrs, s.shdr)
+	}
+	for i := range shdrs {
+		if shdrs[i].Sh_flags&elf.SHF_LINK_ORDER != 0 {
+			shdrs[i].Sh_link = text_shndx
+		}
+	}
+	shstrtab_shdr := elffile.SectionHeader{Sh_name: ".shstrtab",
+		Sh_type: elf.SHT_STRTAB, Sh_offset: file_off, Sh_addralign: 1}
+	shstrtab_shdr.Sh_name_index = addString(&shstrtab, ".shstrtab")
+	shstrtab_shdr.Sh_size = uint64(len(shstrtab))
+	shdrs = append(shdrs, shstrtab_shdr)
+
+	body := make([]byte, file_off+uint64(len(shstrtab)))
+	if nacl.TextFill != 0 {
+		text_start := text.P_offset
+		for i := text_start; i < text_start+text.P_filesz; i++ {
+			body[i] = nacl.TextFill
+		}
+	}
+	for _, s := range out_sections {
+		if s.isNobits() {
+			continue
+		}
+		copy(body[s.shdr.Sh_offset:], s.contents)
+		for _, in := range s.inputs {
+			in_hdr := &files[in.file].Shdrs[in.shndx]
+			copy(body[s.shdr.Sh_offset+in.offset:],
+				files[in.file].Body[in_hdr.Sh_offset:in_hdr.Sh_offset+in_hdr.Sh_size])
+		}
+	}
+	copy(body[file_off:], shstrtab)
+
+	result := elffile.ElfFile{Body: body,
+		Header: elffile.ElfFileHeader{
+			Class:          first.Class,
+			Data:           first.Data,
+			EI_Version:     first.EI_Version,
+			OSABI:          first.OSABI,
+			ABIVersion:     first.ABIVersion,
+			Type:           elf.ET_EXEC,
+			Machine:        first.Machine,
+			E_Version:      first.E_Version,
+			Phoff:          uint64(ehsize),
+			Shoff:          alignUp(uint64(len(body)), 8),
+			Flags:          first.Flags,
+			FileHeaderSize: ehsize,
+			Phentsize:      phentsize,
+			Shentsize:      shentsize},
+		Phdrs: phdrs,
+		Shdrs: shdrs}
+	// The section name table is last.
+	result.SetHeaderCounts(len(shdrs) - 1)
+	return Layout{File: result, Sections: sections, GOT: got,
+		LinkerSyms: linker_syms}, nil
+}
+
+// Find the address of a global symbol, after layout.
+func FindGlobalSymbol(name string, f_syms []elffile.SymbolTable,
+	link_info []resolver.SymLinkInfo) (uint64, bool) {
+	for i := range link_info {
+		k, ok := link_info[i].ExportedSymHash[name]
+		if !ok {
+			continue
+		}
+		if _, overridden := link_info[i].OverriddenSyms[k]; !overridden {
+			return f_syms[i][k].St_value, true
+		}
+	}
+	return 0, false
+}
+
+// Where an input section was placed in the output file.
+type SectionPlacement struct {
+	Placed bool
+	Addr   uint64 // Virtual address.
+	Offset uint64 // Offset into the output file.
+}
+
+// Placement of the input sections, indexed by file index
+// then by section index.
+type InputSectionMap [][]SectionPlacement
+
+func (m InputSectionMap) IsPlaced(file int, shndx int) bool {
+	return file < len(m) && shndx < len(m[file]) && m[file][shndx].Placed
+}
+
+// Describe the layout, for debugging.
+func (l *Layout) String() string {
+	s := ""
+	for i := range l.File.Phdrs {
+		phdr := &l.File.Phdrs[i]
+		s += fmt.Sprintf("%s %s off 0x%x vaddr 0x%x filesz 0x%x memsz 0x%x\n",
+			phdr.P_type, phdr.P_flags, phdr.P_offset, phdr.P_vaddr,
+			phdr.P_filesz, phdr.P_memsz)
+	}
+	return s
+}
@@ -0,0 +1,569 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test the layout of sections into segments.
+
+package layout
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jvoung/go-ld/elffile"
+	. "github.com/jvoung/go-ld/internal/testutil"
+	. "github.com/jvoung/go-ld/internal/testutil/elftest"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+func layoutForTest(t *testing.T, files []elffile.ElfFile,
+	opts LayoutOptions) ([]elffile.SymbolTable, Layout) {
+	f_syms := make([]elffile.SymbolTable, len(files))
+	for i := range files {
+		f_syms[i] = ReadSymbolsForTest(files[i])
+	}
+	link_info := resolver.ResolveSymbols(f_syms)
+	layout, err := DoLayout(f_syms, files, link_info, opts)
+	AssertNoError(t, err)
+	return f_syms, layout
+}
+
+func countSections(name string, f *elffile.ElfFile) int {
+	count := 0
+	for i := range f.Shdrs {
+		if f.Shdrs[i].Sh_name == name {
+			count++
+		}
+	}
+	return count
+}
+
+// Each PT_LOAD should be page aligned (vaddr == offset mod page size),
+// and contain the sections which were assigned to it.
+func checkLoadSegments(t *testing.T, out *elffile.ElfFile, page_size uint64) {
+	for seg := range phdr_order {
+		phdr := &out.Phdrs[seg]
+		ExpectEq(t, elf.PT_LOAD, phdr.P_type)
+		ExpectEq(t, segmentFlags[seg], phdr.P_flags)
+		ExpectEq(t, page_size, phdr.P_align)
+		ExpectEq(t, phdr.P_offset%page_size, phdr.P_vaddr%page_size)
+		ExpectEq(t, phdr.P_vaddr, phdr.P_paddr)
+		if phdr.P_filesz > phdr.P_memsz {
+			t.Errorf("Segment %d filesz 0x%x > memsz 0x%x", seg,
+				phdr.P_filesz, phdr.P_memsz)
+		}
+	}
+	for i := 1; i < len(out.Shdrs); i++ {
+		shdr := &out.Shdrs[i]
+		if shdr.Sh_flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		seg, _ := segmentOf(shdr.Sh_name, shdr.Sh_flags)
+		phdr := &out.Phdrs[seg]
+		if shdr.Sh_addr < phdr.P_vaddr ||
+			shdr.Sh_addr+shdr.Sh_size > phdr.P_vaddr+phdr.P_memsz {
+			t.Errorf("Section %s at 0x%x is outside of segment %d",
+				shdr.Sh_name, shdr.Sh_addr, seg)
+		}
+		ExpectEq(t, uint64(0), shdr.Sh_addr%shdr.Sh_addralign)
+		if shdr.Sh_type != elf.SHT_NOBITS {
+			ExpectEq(t, shdr.Sh_addr-phdr.P_vaddr,
+				shdr.Sh_offset-phdr.P_offset)
+		}
+	}
+}
+
+func TestLayoutX8632(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "crtbegin.o")),
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_got.o")),
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "crtend.o"))}
+	orig_syms := ReadSymbolsForTest(files[1])
+	f_syms, layout := layoutForTest(t, files, LayoutOptions{})
+	out := &layout.File
+	ExpectEq(t, elf.ET_EXEC, out.Header.Type)
+	ExpectEq(t, elf.EM_386, out.Header.Machine)
+	// Three PT_LOADs, a PT_NOTE, and a PT_GNU_STACK.
+	AssertEq(t, 5, len(out.Phdrs))
+	ExpectEq(t, elf.PT_NOTE, out.Phdrs[3].P_type)
+	ExpectEq(t, elf.PT_GNU_STACK, out.Phdrs[4].P_type)
+	// The headers are mapped at the start of the text segment.
+	ExpectEq(t, uint64(0), out.Phdrs[0].P_offset)
+	ExpectEq(t, uint64(0x8048000), out.Phdrs[0].P_vaddr)
+	checkLoadSegments(t, out, 0x1000)
+
+	// .text.__x86.get_pc_thunk.ax goes into .text, and the .note is a
+	// COMDAT group in both crtbegin.o and crtend.o, so only one is kept.
+	ExpectEq(t, 1, countSections(".text", out))
+	ExpectEq(t, 0, countSections(".text.__x86.get_pc_thunk.ax", out))
+	ExpectEq(t, 1, countSections(".note.NaCl.ABI.x86-32", out))
+	note := out.Shdrs[FindSectionIndexForTest(".note.NaCl.ABI.x86-32", out)]
+	ExpectEq(t, files[0].Shdrs[FindSectionIndexForTest(".note.NaCl.ABI.x86-32",
+		&files[0])].Sh_size, note.Sh_size)
+	ExpectEq(t, false, layout.Sections.IsPlaced(2,
+		FindSectionIndexForTest(".note.NaCl.ABI.x86-32", &files[2])))
+	ExpectEq(t, note.Sh_addr, out.Phdrs[3].P_vaddr)
+
+	// The input sections are concatenated in file order, aligned.
+	text := out.Shdrs[FindSectionIndexForTest(".text", out)]
+	prev_end := text.Sh_addr
+	for i := range files {
+		shndx := FindSectionIndexForTest(".text", &files[i])
+		placement := layout.Sections[i][shndx]
+		AssertEq(t, true, placement.Placed)
+		ExpectEq(t, uint64(0), placement.Addr%files[i].Shdrs[shndx].Sh_addralign)
+		if placement.Addr < prev_end {
+			t.Errorf("Input .text %d at 0x%x overlaps previous (end 0x%x)",
+				i, placement.Addr, prev_end)
+		}
+		ExpectEq(t, placement.Offset-text.Sh_offset, placement.Addr-text.Sh_addr)
+		in_hdr := &files[i].Shdrs[shndx]
+		if !bytes.Equal(files[i].Body[in_hdr.Sh_offset:in_hdr.Sh_offset+16],
+			out.Body[placement.Offset:placement.Offset+16]) {
+			t.Errorf("Input .text %d was not copied to the output", i)
+		}
+		prev_end = placement.Addr + in_hdr.Sh_size
+	}
+	ExpectEq(t, text.Sh_addr+text.Sh_size, prev_end)
+
+	// Symbols are now absolute.
+	for _, name := range []string{"GetGlobal", "global_value", "local_counter"} {
+		for k := range orig_syms {
+			if orig_syms[k].St_name != name {
+				continue
+			}
+			shndx := int(orig_syms[k].St_shndx)
+			ExpectEqM(t, layout.Sections[1][shndx].Addr+orig_syms[k].St_value,
+				f_syms[1][k].St_value, name)
+		}
+	}
+
+	// The .got comes after the .data, and the .bss is last.
+	data_index := FindSectionIndexForTest(".data", out)
+	got_index := FindSectionIndexForTest(".got", out)
+	bss_index := FindSectionIndexForTest(".bss", out)
+	if !(data_index < got_index && got_index < bss_index) {
+		t.Errorf("Expected .data < .got < .bss, got %d %d %d",
+			data_index, got_index, bss_index)
+	}
+	ExpectEq(t, out.Shdrs[got_index].Sh_addr, layout.GOT.Addr)
+	ExpectEq(t, out.Shdrs[got_index].Sh_offset, layout.GOT.Offset)
+	ExpectEq(t, layout.GOT.Addr, layout.LinkerSyms["_GLOBAL_OFFSET_TABLE_"])
+
+	// Make sure that the standard library can read the output.
+	std_file, err := elf.NewFile(bytes.NewReader(elffile.WriteElfFile(out)))
+	if err != nil {
+		t.Fatal("debug/elf failed to parse the output:", err)
+	}
+	ExpectEq(t, ".shstrtab", std_file.Sections[len(std_file.Sections)-1].Name)
+	ExpectEq(t, ".text", std_file.Section(".text").Name)
+}
+
+func TestLayoutMIPS(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestMIPSBaseDir(), "crtbegin.o")),
+		ReadElfFileFname(path.Join(TestMIPSBaseDir(), "crtend.o"))}
+	_, layout := layoutForTest(t, files, LayoutOptions{})
+	out := &layout.File
+	ExpectEq(t, elf.EM_MIPS, out.Header.Machine)
+	ExpectEq(t, files[0].Header.Flags, out.Header.Flags)
+	checkLoadSegments(t, out, 0x10000)
+	// The .reginfo sections are merged into one, with the final _gp.
+	AssertEq(t, 1, countSections(".reginfo", out))
+	reginfo := out.Shdrs[FindSectionIndexForTest(".reginfo", out)]
+	ExpectEq(t, uint64(mipsRegInfoSize), reginfo.Sh_size)
+	gp := layout.LinkerSyms["_gp"]
+	ExpectEq(t, layout.GOT.Addr+MIPSGPOffset, gp)
+	ExpectEq(t, uint32(gp), elffile.ToByteOrder(out.Header.Data).Uint32(
+		out.Body[reginfo.Sh_offset+20:]))
+}
+
+// Inputs for another class, data encoding or machine than the first are
+// rejected, naming the input which doesn't match.
+func TestLayoutMismatchedInputs(t *testing.T) {
+	x8632 := ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_got.o"))
+	x8664 := ReadElfFileFname(path.Join(TestX8664BaseDir(), "test_got.o"))
+	arm := ReadElfFileFname(path.Join(TestARMBaseDir(), "crtbegin.o"))
+	x8632_syms := ReadSymbolsForTest(x8632)
+	// Only the header is changed (the symbols were read already).
+	big_endian := x8632
+	big_endian.Header.Data = elf.ELFDATA2MSB
+	tests := []struct {
+		second   elffile.ElfFile
+		syms     elffile.SymbolTable
+		expected string
+	}{
+		{x8664, ReadSymbolsForTest(x8664),
+			"b.o:0x4: ELF class ELFCLASS64 does not match ELFCLASS32 of a.o"},
+		{big_endian, x8632_syms, "b.o:0x5: ELF data encoding ELFDATA2MSB " +
+			"does not match ELFDATA2LSB of a.o"},
+		{arm, ReadSymbolsForTest(arm),
+			"b.o:0x12: machine EM_ARM does not match EM_386 of a.o"},
+	}
+	for _, test := range tests {
+		files := []elffile.ElfFile{x8632, test.second}
+		f_syms := []elffile.SymbolTable{x8632_syms, test.syms}
+		link_info := resolver.ResolveSymbols(f_syms)
+		_, err := DoLayout(f_syms, files, link_info,
+			LayoutOptions{ObjectNames: []string{"a.o", "b.o"}})
+		AssertEq(t, false, err == nil)
+		var input_err *elffile.InputError
+		ExpectEq(t, true, errors.As(err, &input_err))
+		ExpectEq(t, test.expected, err.Error())
+	}
+}
+
+// COMMON symbols of the same name are merged and allocated in .bss,
+// unless a real definition overrides them.
+func TestLayoutCommonSymbols(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_common_a.o")),
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_common_b.o"))}
+	f_syms := []elffile.SymbolTable{ReadSymbolsForTest(files[0]),
+		ReadSymbolsForTest(files[1])}
+	link_info := resolver.ResolveSymbols(f_syms)
+	layout, err := DoLayout(f_syms, files, link_info, LayoutOptions{})
+	AssertNoError(t, err)
+	out := &layout.File
+	checkLoadSegments(t, out, 0x1000)
+	AssertEq(t, 1, countSections(".bss", out))
+	bss := out.Shdrs[FindSectionIndexForTest(".bss", out)]
+	ExpectEq(t, elf.SHT_NOBITS, bss.Sh_type)
+	ExpectEq(t, elf.SHF_ALLOC|elf.SHF_WRITE, bss.Sh_flags)
+	ExpectEq(t, uint64(32), bss.Sh_addralign)
+	c := RelocContext{Files: files, Syms: f_syms, LinkInfo: link_info}
+	inBss := func(file int, name string, size uint64, align uint64) {
+		def := c.Definition(file, symbolIndexForTest(t, f_syms[file], name))
+		ExpectEqM(t, SymRef{0, symbolIndexForTest(t, f_syms[0], name)}, def,
+			name)
+		sym := &f_syms[def.File][def.Sym]
+		ExpectEqM(t, elf.SHN_ABS, sym.St_shndx, name)
+		ExpectEqM(t, size, sym.St_size, name)
+		ExpectEqM(t, uint64(0), sym.St_value%align, name)
+		ExpectEqM(t, true, sym.St_value >= bss.Sh_addr &&
+			sym.St_value+size <= bss.Sh_addr+bss.Sh_size, name)
+	}
+	inBss(0, "common_a", 4, 4)
+	// The largest size (from the second file) and strictest alignment.
+	inBss(0, "common_merged", 64, 32)
+	inBss(1, "common_merged", 64, 32)
+
+	// The definition in .data overrides the COMMON symbol.
+	overridden := c.Definition(0,
+		symbolIndexForTest(t, f_syms[0], "common_overridden"))
+	ExpectEq(t, SymRef{1,
+		symbolIndexForTest(t, f_syms[1], "common_overridden")}, overridden)
+	data := out.Shdrs[FindSectionIndexForTest(".data", out)]
+	ExpectEq(t, data.Sh_addr, c.SymbolAddress(0,
+		symbolIndexForTest(t, f_syms[0], "common_overridden")))
+	// Only common_merged and then common_a take up space.
+	ExpectEq(t, uint64(64+4), bss.Sh_size)
+}
+
+// Lay out, relocate and write the files with the NaCl layout, returning
+// the output file name.
+func linkNaClForTest(t *testing.T, files []elffile.ElfFile) (string, InputSectionMap) {
+	f_syms := make([]elffile.SymbolTable, len(files))
+	for i := range files {
+		f_syms[i] = ReadSymbolsForTest(files[i])
+	}
+	link_info := resolver.ResolveSymbols(f_syms)
+	layout, err := DoLayout(f_syms, files, link_info,
+		LayoutOptions{Mode: NaClLayout, EhFrameHdr: true})
+	AssertNoError(t, err)
+	checkLoadSegments(t, &layout.File, naclPageSize)
+	c := RelocContext{Files: files, Syms: f_syms, LinkInfo: link_info,
+		Sections:   layout.Sections,
+		Out:        layout.File.Body,
+		ByteOrder:  elffile.ToByteOrder(layout.File.Header.Data),
+		GOT:        layout.GOT,
+		LinkerSyms: layout.LinkerSyms}
+	AssertEq(t, 0, len(c.ApplyRelocations(make([]string, len(files)))))
+	c.FillGOT()
+	dir, err := ioutil.TempDir("", "go-ld-layout")
+	if err != nil {
+		t.Fatal("Failed to make temp dir", err)
+	}
+	fname := path.Join(dir, "test.nexe")
+	AssertNoError(t, elffile.WriteElfFileFname(&layout.File, fname))
+	return fname, layout.Sections
+}
+
+// Code is in 32-byte bundles, and x86 fills the gaps with hlt.
+func checkNaClText(t *testing.T, fname string, files []elffile.ElfFile,
+	sections InputSectionMap, fill byte) {
+	out := ReadElfFileFname(fname)
+	text := &out.Phdrs[textSegment]
+	ExpectEq(t, uint64(0), text.P_filesz%naclBundleSize)
+	for i := 1; i < len(out.Shdrs); i++ {
+		shdr := &out.Shdrs[i]
+		if shdr.Sh_flags&elf.SHF_EXECINSTR != 0 {
+			ExpectEq(t, uint64(0), shdr.Sh_addr%naclBundleSize)
+			ExpectEq(t, uint64(0), shdr.Sh_size%naclBundleSize)
+		}
+	}
+	padded := 0
+	for i := range files {
+		shndx := FindSectionIndexForTest(".text", &files[i])
+		size := files[i].Shdrs[shndx].Sh_size
+		if size%naclBundleSize != 0 {
+			ExpectEq(t, fill, out.Body[sections[i][shndx].Offset+size])
+			padded++
+		}
+	}
+	if padded == 0 {
+		t.Error("Expected some .text to need padding")
+	}
+	// The headers are only mapped in the rodata segment.
+	ExpectEq(t, uint64(0), out.Phdrs[rodataSegment].P_offset)
+	eh_frame_hdr := out.Shdrs[FindSectionIndexForTest(".eh_frame_hdr", &out)]
+	found := false
+	for i := range out.Phdrs {
+		if out.Phdrs[i].P_type == elf.PT_GNU_EH_FRAME {
+			ExpectEq(t, eh_frame_hdr.Sh_addr, out.Phdrs[i].P_vaddr)
+			found = true
+		}
+	}
+	ExpectEq(t, true, found)
+}
+
+func alignTo(addr uint64, alignment uint64) uint64 {
+	diff := (alignment - (addr % alignment)) % alignment
+	return addr + diff
+}
+
+func checkExecutableX8632NaCl(t *testing.T, fname string) {
+	elf_file := ReadElfFileFname(fname)
+	ExpectEq(t, elf.ELFCLASS32, elf_file.Header.Class)
+	ExpectEq(t, elf.ELFDATA2LSB, elf_file.Header.Data)
+	ExpectEq(t, elf.EV_CURRENT, elf_file.Header.EI_Version)
+	ExpectEq(t, elf.ELFOSABI_NONE, elf_file.Header.OSABI)
+	ExpectEq(t, uint8(0), elf_file.Header.ABIVersion)
+	ExpectEq(t, elf.ET_EXEC, elf_file.Header.Type)
+	ExpectEq(t, elf.EM_386, elf_file.Header.Machine)
+	ExpectEq(t, 6, len(elf_file.Phdrs))
+
+	// Check Phdrs
+	ExpectEq(t, elf_file.Phdrs[0].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[0].P_flags, elf.PF_R|elf.PF_X)
+	ExpectEq(t, elf_file.Phdrs[0].P_offset, uint64(0x10000))
+	ExpectEq(t, elf_file.Phdrs[0].P_vaddr, uint64(0x20000))
+	ExpectEq(t, elf_file.Phdrs[0].P_paddr, uint64(0x20000))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
+
+	ExpectEq(t, elf_file.Phdrs[1].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[1].P_flags, elf.PF_R)
+	ExpectEq(t, elf_file.Phdrs[1].P_offset, uint64(0))
+	ExpectEq(t, elf_file.Phdrs[1].P_vaddr, uint64(0x10020000))
+	ExpectEq(t, elf_file.Phdrs[1].P_paddr, uint64(0x10020000))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[1].P_align, uint64(0x10000))
+
+	ExpectEq(t, elf_file.Phdrs[2].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[2].P_flags, elf.PF_R|elf.PF_W)
+	// relative to the size of the previous segment.
+	ExpectEq(t, elf_file.Phdrs[2].P_offset,
+		alignTo(elf_file.Phdrs[1].P_filesz, 32))
+	ExpectEq(t, elf_file.Phdrs[2].P_vaddr,
+		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
+	ExpectEq(t, elf_file.Phdrs[2].P_paddr,
+		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
+}
+
+func checkExecutableX8664NaCl(t *testing.T, fname string) {
+	elf_file := ReadElfFileFname(fname)
+	ExpectEq(t, elf.ELFCLASS64, elf_file.Header.Class)
+	ExpectEq(t, elf.ELFDATA2LSB, elf_file.Header.Data)
+	ExpectEq(t, elf.EV_CURRENT, elf_file.Header.EI_Version)
+	ExpectEq(t, elf.ELFOSABI_NONE, elf_file.Header.OSABI)
+	ExpectEq(t, uint8(0), elf_file.Header.ABIVersion)
+	ExpectEq(t, elf.ET_EXEC, elf_file.Header.Type)
+	ExpectEq(t, elf.EM_X86_64, elf_file.Header.Machine)
+	ExpectEq(t, 6, len(elf_file.Phdrs))
+
+	// Check Phdrs
+	ExpectEq(t, elf_file.Phdrs[0].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[0].P_flags, elf.PF_R|elf.PF_X)
+	ExpectEq(t, elf_file.Phdrs[0].P_offset, uint64(0x10000))
+	ExpectEq(t, elf_file.Phdrs[0].P_vaddr, uint64(0x20000))
+	ExpectEq(t, elf_file.Phdrs[0].P_paddr, uint64(0x20000))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
+
+	ExpectEq(t, elf_file.Phdrs[1].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[1].P_flags, elf.PF_R)
+	ExpectEq(t, elf_file.Phdrs[1].P_offset, uint64(0))
+	ExpectEq(t, elf_file.Phdrs[1].P_vaddr, uint64(0x10020000))
+	ExpectEq(t, elf_file.Phdrs[1].P_paddr, uint64(0x10020000))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[1].P_align, uint64(0x10000))
+
+	ExpectEq(t, elf_file.Phdrs[2].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[2].P_flags, elf.PF_R|elf.PF_W)
+	// relative to the size of the previous segment.
+	ExpectEq(t, elf_file.Phdrs[2].P_offset,
+		alignTo(elf_file.Phdrs[1].P_filesz, 32))
+	ExpectEq(t, elf_file.Phdrs[2].P_vaddr,
+		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
+	ExpectEq(t, elf_file.Phdrs[2].P_paddr,
+		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 32))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
+}
+
+func checkExecutableARMNaCl(t *testing.T, fname string) {
+	elf_file := ReadElfFileFname(fname)
+	ExpectEq(t, elf.ELFCLASS32, elf_file.Header.Class)
+	ExpectEq(t, elf.ELFDATA2LSB, elf_file.Header.Data)
+	ExpectEq(t, elf.EV_CURRENT, elf_file.Header.EI_Version)
+	ExpectEq(t, elf.ELFOSABI_NONE, elf_file.Header.OSABI)
+	ExpectEq(t, uint8(0), elf_file.Header.ABIVersion)
+	ExpectEq(t, elf.ET_EXEC, elf_file.Header.Type)
+	ExpectEq(t, elf.EM_ARM, elf_file.Header.Machine)
+	// The ARM one doesn't have a GNU_STACK segment so it's only 5 segments.
+	ExpectEq(t, 5, len(elf_file.Phdrs))
+
+	// Check Phdrs
+	ExpectEq(t, elf_file.Phdrs[0].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[0].P_flags, elf.PF_R|elf.PF_X)
+	ExpectEq(t, elf_file.Phdrs[0].P_offset, uint64(0x10000))
+	ExpectEq(t, elf_file.Phdrs[0].P_vaddr, uint64(0x20000))
+	ExpectEq(t, elf_file.Phdrs[0].P_paddr, uint64(0x20000))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
+
+	ExpectEq(t, elf_file.Phdrs[1].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[1].P_flags, elf.PF_R)
+	ExpectEq(t, elf_file.Phdrs[1].P_offset, uint64(0))
+	ExpectEq(t, elf_file.Phdrs[1].P_vaddr, uint64(0x10020000))
+	ExpectEq(t, elf_file.Phdrs[1].P_paddr, uint64(0x10020000))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[1].P_align, uint64(0x10000))
+
+	ExpectEq(t, elf_file.Phdrs[2].P_type, elf.PT_LOAD)
+	ExpectEq(t, elf_file.Phdrs[2].P_flags, elf.PF_R|elf.PF_W)
+	// relative to the size of the previous segment.
+	// TODO(jvoung): what is the alignment requirement???
+	ExpectEq(t, elf_file.Phdrs[2].P_offset,
+		alignTo(elf_file.Phdrs[1].P_filesz, 8))
+	ExpectEq(t, elf_file.Phdrs[2].P_vaddr,
+		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 8))
+	ExpectEq(t, elf_file.Phdrs[2].P_paddr,
+		alignTo(uint64(0x10030000+elf_file.Phdrs[1].P_filesz), 8))
+	// Skip the sizes, because they can change.
+	ExpectEq(t, elf_file.Phdrs[0].P_align, uint64(0x10000))
+}
+
+func lastModTime(files []string, can_skip bool) time.Time {
+	t := time.Time{}
+	for _, fname := range files {
+		stat, err := os.Stat(fname)
+		if err != nil {
+			if can_skip {
+				continue
+			} else {
+				panic("Failed to stat: " + fname)
+			}
+		}
+		if stat.ModTime().After(t) {
+			t = stat.ModTime()
+		}
+	}
+	return t
+}
+
+func naclTestDataOld(infiles, outfiles []string) bool {
+	max_in_mod := lastModTime(infiles, false)
+	max_out_mod := lastModTime(outfiles, true)
+	return max_in_mod.After(max_out_mod)
+}
+
+func TestNaClExecutable(t *testing.T) {
+	// Use the test_binary shell script to generate a NaCl .nexe
+	// then read it.
+	infiles := []string{path.Join(TestBaseDir, "test_relocs.sh"),
+		path.Join(TestBaseDir, "test_relocs.c")}
+	outdirs := []string{TestX8632BaseDir(), TestX8664BaseDir(),
+		TestARMBaseDir()}
+	outfiles := []string{"test_relocs.o",
+		"test_relocs.nexe",
+		"test_relocs.nexe---test_relocs.final.pexe---.o"}
+	joined_of := []string{}
+	for _, od := range outdirs {
+		for _, of := range outfiles {
+			joined_of = append(joined_of, path.Join(od, of))
+		}
+	}
+	if naclTestDataOld(infiles, joined_of) {
+		fmt.Println("Need to regenerate relocs test binaries: test_relocs.sh")
+		cmd := exec.Command(path.Join(TestBaseDir, "test_relocs.sh"))
+		// The script expects to be run from the top of the repository.
+		cmd.Dir = path.Dir(TestBaseDir)
+		err := cmd.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkExecutableX8632NaCl(
+		t, path.Join(TestX8632BaseDir(), "test_relocs.nexe"))
+	checkExecutableX8664NaCl(
+		t, path.Join(TestX8664BaseDir(), "test_relocs.nexe"))
+	checkExecutableARMNaCl(
+		t, path.Join(TestARMBaseDir(), "test_relocs.nexe"))
+}
+
+func TestLayoutNaClX8632(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "crtbegin.o")),
+		readARMemberForTest(t,
+			path.Join(TestX8632BaseDir(), "libpnacl_irt_shim.a"), "shim_entry.o"),
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_got.o")),
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "crtend.o"))}
+	fname, sections := linkNaClForTest(t, files)
+	defer os.RemoveAll(path.Dir(fname))
+	checkExecutableX8632NaCl(t, fname)
+	checkNaClText(t, fname, files, sections, 0xf4)
+	out := ReadElfFileFname(fname)
+	ExpectEq(t, elf.PT_GNU_EH_FRAME, out.Phdrs[4].P_type)
+	ExpectEq(t, elf.PT_GNU_STACK, out.Phdrs[5].P_type)
+	// The .eh_frame_hdr points at the .eh_frame.
+	hdr := out.Shdrs[FindSectionIndexForTest(".eh_frame_hdr", &out)]
+	eh_frame := out.Shdrs[FindSectionIndexForTest(".eh_frame", &out)]
+	ExpectEq(t, true, bytes.Equal([]byte{1, 0x1b, 0xff, 0xff},
+		out.Body[hdr.Sh_offset:hdr.Sh_offset+4]))
+	ExpectEq(t, uint32(eh_frame.Sh_addr-(hdr.Sh_addr+4)),
+		elffile.ToByteOrder(out.Header.Data).Uint32(out.Body[hdr.Sh_offset+4:]))
+}
+
+func TestLayoutNaClX8664(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8664BaseDir(), "crtbegin.o")),
+		readARMemberForTest(t,
+			path.Join(TestX8664BaseDir(), "libpnacl_irt_shim.a"), "shim_entry.o"),
+		ReadElfFileFname(path.Join(TestX8664BaseDir(), "test_got.o")),
+		ReadElfFileFname(path.Join(TestX8664BaseDir(), "crtend.o"))}
+	fname, sections := linkNaClForTest(t, files)
+	defer os.RemoveAll(path.Dir(fname))
+	checkExecutableX8664NaCl(t, fname)
+	checkNaClText(t, fname, files, sections, 0xf4)
+}
+
+func TestLayoutNaClARM(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestARMBaseDir(), "crtbegin.o")),
+		ReadElfFileFname(path.Join(TestARMBaseDir(), "crtend.o"))}
+	fname, sections := linkNaClForTest(t, files)
+	defer os.RemoveAll(path.Dir(fname))
+	checkExecutableARMNaCl(t, fname)
+	checkNaClText(t, fname, files, sections, 0)
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Apply relocations to the laid-out sections. The generic parts
+// (finding symbol addresses, the GOT) are here, and the machine-specific
+// bits are in relocs_<arch>.go. The .rel/.rela sections are read by
+// elffile.ReadRelocations.
+
+package layout
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/jvoung/go-ld/elffile"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+// Identifies a symbol by file index and symbol table index.
+type SymRef struct {
+	File int
+	Sym  uint32
+}
+
+// A GOT slot. Normally it holds the absolute address of a symbol.
+// MIPS also has "page" slots for local symbols, which hold the 64KB page
+// of the symbol + Addend, and are shared by all references to that page.
+type GOTEntry struct {
+	Ref    SymRef
+	Page   bool
+	Addend int64
+}
+
+// The global offset table built by the linker. For a static link
+// each slot is filled with a constant.
+type GOT struct {
+	Addr    uint64 // Address and file offset are assigned during layout.
+	Offset  uint64
+	EntSize uint64
+	Entries []GOTEntry
+	index   map[GOTEntry]int
+}
+
+func NewGOT(entsize uint64) *GOT {
+	return &GOT{EntSize: entsize, index: make(map[GOTEntry]int)}
+}
+
+func (g *GOT) Size() uint64 {
+	return uint64(len(g.Entries)) * g.EntSize
+}
+
+func (g *GOT) addEntry(e GOTEntry) {
+	if _, ok := g.index[e]; ok {
+		return
+	}
+	g.index[e] = len(g.Entries)
+	g.Entries = append(g.Entries, e)
+}
+
+func (g *GOT) entryAddr(e GOTEntry) uint64 {
+	i, ok := g.index[e]
+	if !ok {
+		panic(fmt.Sprintf("No GOT entry for symbol %v", e.Ref))
+	}
+	return g.Addr + uint64(i)*g.EntSize
+}
+
+// Reserve a slot for the symbol (if it doesn't already have one).
+func (g *GOT) Add(ref SymRef) {
+	g.addEntry(GOTEntry{Ref: ref})
+}
+
+// Address of the GOT slot for the symbol.
+func (g *GOT) EntryAddr(ref SymRef) uint64 {
+	return g.entryAddr(GOTEntry{Ref: ref})
+}
+
+// Reserve a page slot for the symbol + addend.
+func (g *GOT) AddPage(ref SymRef, addend int64) {
+	g.addEntry(GOTEntry{Ref: ref, Page: true, Addend: addend})
+}
+
+// Address of the page slot for the symbol + addend.
+func (g *GOT) PageEntryAddr(ref SymRef, addend int64) uint64 {
+	return g.entryAddr(GOTEntry{Ref: ref, Page: true, Addend: addend})
+}
+
+// Machine-specific relocation handling.
+type relocTarget struct {
+	// GOT slot size in bytes.
+	gotEntSize uint64
+	// Whether the relocation type refers to a GOT slot for the symbol.
+	needsGOT func(typ uint32) bool
+	// Optional. Used instead of needsGOT when the kind of slot depends on
+	// more than the relocation type.
+	reserveGOT func(c *RelocContext, got *GOT, file int, rel elffile.Relocation)
+	// Optional. For REL-style relocations whose addend depends on other
+	// relocations (e.g., a MIPS HI16 and its LO16), fill in the addends
+	// given the original section contents.
+	pairAddends func(c *RelocContext, file int, rels []elffile.Relocation, in []byte)
+	// Patch the place at rel.Offset within the placed section contents.
+	// P is the address of the place. Errors are for relocations which
+	// can't be applied (e.g., an unknown type, or an overflow).
+	apply func(c *RelocContext, file int, rel elffile.Relocation, sec []byte,
+		P uint64) error
+}
+
+// Filled in by the init() of each relocs_<arch>.go.
+var relocTargets = map[elf.Machine]relocTarget{}
+
+// The machine is checked by DoLayout, before any relocations are
+// scanned or applied.
+func getRelocTarget(m elf.Machine) relocTarget {
+	target, ok := relocTargets[m]
+	if !ok {
+		panic("Relocations not supported for machine: " + m.String())
+	}
+	return target
+}
+
+// Everything needed to apply the relocations of the input files.
+type RelocContext struct {
+	Files []elffile.ElfFile
+	// Symbol values are expected to already be absolute addresses
+	// (see DoLayout).
+	Syms     []elffile.SymbolTable
+	LinkInfo []resolver.SymLinkInfo
+	Sections InputSectionMap
+	// The output file contents, patched in place.
+	Out       []byte
+	ByteOrder binary.ByteOrder
+	GOT       *GOT
+	// Symbols defined by the linker itself (e.g., _GLOBAL_OFFSET_TABLE_),
+	// used for undefined symbols which no file defines.
+	LinkerSyms map[string]uint64
+}
+
+// Find the definition of the symbol, following undefined symbols (and
+// overridden definitions) to the file that defines them. An unresolved
+// symbol is returned as is.
+func (c *RelocContext) Definition(file int, sym uint32) SymRef {
+	st_entry := &c.Syms[file][sym]
+	if st_entry.St_shndx != elf.SHN_UNDEF {
+		if r, ok := c.LinkInfo[file].OverriddenSyms[int(sym)]; ok {
+			return SymRef{r.DefFileIndex, uint32(r.DefSymIndex)}
+		}
+		return SymRef{file, sym}
+	}
+	if r, ok := c.LinkInfo[file].UndefinedSyms[int(sym)]; ok &&
+		r.DefSymIndex != 0 {
+		return SymRef{r.DefFileIndex, uint32(r.DefSymIndex)}
+	}
+	return SymRef{file, sym}
+}
+
+// The absolute address of the symbol. Unresolved symbols (e.g., weak
+// undefined symbols) are 0 unless the linker defines them.
+func (c *RelocContext) SymbolAddress(file int, sym uint32) uint64 {
+	def := c.Definition(file, sym)
+	st_entry := &c.Syms[def.File][def.Sym]
+	if st_entry.St_shndx != elf.SHN_UNDEF {
+		return st_entry.St_value
+	}
+	if addr, ok := c.LinkerSyms[st_entry.St_name]; ok {
+		return addr
+	}
+	return 0
+}
+
+// Read the relocations of a section and fill in any paired addends.
+func readRelocsForTarget(c *RelocContext, target relocTarget, file int,
+	shndx int) []elffile.Relocation {
+	f := &c.Files[file]
+	rels, err := f.ReadRelocations(shndx)
+	if err != nil {
+		// The relocations were checked when the file was read.
+		panic(err)
+	}
+	if target.pairAddends != nil {
+		in_hdr := &f.Shdrs[f.Shdrs[shndx].Sh_info]
+		in := f.Body[in_hdr.Sh_offset : in_hdr.Sh_offset+in_hdr.Sh_size]
+		target.pairAddends(c, file, rels, in)
+	}
+	return rels
+}
+
+// Go through the relocations that apply to placed sections and reserve
+// GOT slots for those that need them. This has to happen before layout
+// so that the .got size is known.
+func ScanGOTRelocs(files []elffile.ElfFile, f_syms []elffile.SymbolTable,
+	link_info []resolver.SymLinkInfo, sections InputSectionMap) *GOT {
+	if len(files) == 0 {
+		return nil
+	}
+	target := getRelocTarget(files[0].Header.Machine)
+	got := NewGOT(target.gotEntSize)
+	c := RelocContext{Files: files, Syms: f_syms, LinkInfo: link_info,
+		ByteOrder: elffile.ToByteOrder(files[0].Header.Data)}
+	for i := range files {
+		f := &files[i]
+		for j := range f.Shdrs {
+			shdr := &f.Shdrs[j]
+			if !elffile.IsRelocSection(shdr) || !sections.IsPlaced(i, int(shdr.Sh_info)) {
+				continue
+			}
+			for _, rel := range readRelocsForTarget(&c, target, i, j) {
+				if target.reserveGOT != nil {
+					target.reserveGOT(&c, got, i, rel)
+				} else if target.needsGOT(rel.Type) {
+					got.Add(c.Definition(i, rel.Sym))
+				}
+			}
+		}
+	}
+	return got
+}
+
+// Write the symbol addresses into the GOT slots.
+// Assumes the GOT has already been placed in the output.
+func (c *RelocContext) FillGOT() {
+	if c.GOT == nil {
+		return
+	}
+	for i, e := range c.GOT.Entries {
+		addr := c.SymbolAddress(e.Ref.File, e.Ref.Sym)
+		if e.Page {
+			addr = (addr + uint64(e.Addend) + 0x8000) &^ 0xffff
+		}
+		slot := c.Out[c.GOT.Offset+uint64(i)*c.GOT.EntSize:]
+		if c.GOT.EntSize == 8 {
+			c.ByteOrder.PutUint64(slot, addr)
+		} else {
+			c.ByteOrder.PutUint32(slot, uint32(addr))
+		}
+	}
+}
+
+func (c *RelocContext) read32(sec []byte, off uint64) uint32 {
+	if off+4 > uint64(len(sec)) {
+		panic(fmt.Sprintf("Relocation at 0x%x runs past the section", off))
+	}
+	return c.ByteOrder.Uint32(sec[off:])
+}
+
+func (c *RelocContext) write32(sec []byte, off uint64, v uint32) {
+	if off+4 > uint64(len(sec)) {
+		panic(fmt.Sprintf("Relocation at 0x%x runs past the section", off))
+	}
+	c.ByteOrder.PutUint32(sec[off:], v)
+}
+
+// Apply all the relocations from each file to the sections that were
+// placed in the output. The relocations which can't be applied are
+// returned as errors with their place, like "a.o:(.text+0x10): ...",
+// where object_names are the names of the files.
+func (c *RelocContext) ApplyRelocations(object_names []string) []error {
+	var errs []error
+	for i := range c.Files {
+		f := &c.Files[i]
+		target := getRelocTarget(f.Header.Machine)
+		for j := range f.Shdrs {
+			shdr := &f.Shdrs[j]
+			target_index := int(shdr.Sh_info)
+			if !elffile.IsRelocSection(shdr) || !c.Sections.IsPlaced(i, target_index) {
+				continue
+			}
+			loc := c.Sections[i][target_index]
+			target_size := f.Shdrs[target_index].Sh_size
+			// The places are within the section (checked when the
+			// relocations were read), so read32, etc. don't run past it.
+			for _, rel := range readRelocsForTarget(c, target, i, j) {
+				sec := c.Out[loc.Offset : loc.Offset+target_size]
+				err := target.apply(c, i, rel, sec, loc.Addr+rel.Offset)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s:(%s+0x%x): %s",
+						object_names[i], f.Shdrs[target_index].Sh_name,
+						rel.Offset, err))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (c *RelocContext) write64(sec []byte, off uint64, v uint64) {
+	if off+8 > uint64(len(sec)) {
+		panic(fmt.Sprintf("Relocation at 0x%x runs past the section", off))
+	}
+	c.ByteOrder.PutUint64(sec[off:], v)
+}
+
+func fitsSigned(v int64, bits uint) bool {
+	return v >= -(int64(1)<<(bits-1)) && v < int64(1)<<(bits-1)
+}
+
+func fitsUnsigned(v uint64, bits uint) bool {
+	return v < uint64(1)<<bits
+}
+
+// An error about which relocation overflowed (ApplyRelocations adds
+// where the relocation is).
+func relocOverflow(c *RelocContext, file int, rel elffile.Relocation, typ string,
+	v uint64) error {
+	return fmt.Errorf("relocation %s against '%s' out of range: 0x%x", typ,
+		c.Syms[file][rel.Sym].St_name, v)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Relocations for ARM (EM_ARM). These are REL-style, so the addend
+// has to be extracted from the instruction (or data word) being patched.
+
+package layout
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+func init() {
+	relocTargets[elf.EM_ARM] = relocTarget{
+		gotEntSize: 4,
+		needsGOT:   needsGOTARM,
+		apply:      applyRelocARM}
+}
+
+func needsGOTARM(typ uint32) bool {
+	return false
+}
+
+func signExtend(v uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64(v<<shift) >> shift
+}
+
+// The imm16 of a MOVW / MOVT is split into imm4:imm12.
+func armMovImm(insn uint32) uint32 {
+	return ((insn >> 4) & 0xf000) | (insn & 0xfff)
+}
+
+func armSetMovImm(insn uint32, imm uint32) uint32 {
+	return (insn &^ 0xf0fff) | ((imm & 0xf000) << 4) | (imm & 0xfff)
+}
+
+// Extract the implicit addend from the place.
+func armImplicitAddend(typ elf.R_ARM, insn uint32) int64 {
+	switch typ {
+	case elf.R_ARM_CALL, elf.R_ARM_JUMP24, elf.R_ARM_PLT32:
+		addend := signExtend(uint64(insn&0xffffff)<<2, 26)
+		if insn>>28 == 0xf {
+			// BLX <label>: the H bit is bit 1 of the offset.
+			addend += int64(insn>>24&1) << 1
+		}
+		return addend
+	case elf.R_ARM_MOVW_ABS_NC, elf.R_ARM_MOVT_ABS:
+		return signExtend(uint64(armMovImm(insn)), 16)
+	case elf.R_ARM_PREL31:
+		return signExtend(uint64(insn&0x7fffffff), 31)
+	}
+	return int64(int32(insn))
+}
+
+// Patch a B / BL / BLX with a 24-bit word offset. Calls can switch
+// between BL and BLX if the target is Thumb (bit 0 set) or ARM, but
+// plain branches can't switch modes without a veneer.
+func armBranch(c *RelocContext, file int, rel elffile.Relocation, insn uint32,
+	S uint64, A int64, P uint64) (uint32, error) {
+	typ := elf.R_ARM(rel.Type)
+	is_thumb := S&1 != 0
+	is_blx := insn>>28 == 0xf
+	v := (S &^ 1) + uint64(A) - P
+	if !fitsSigned(int64(v), 26) {
+		return 0, relocOverflow(c, file, rel, typ.String(), v)
+	}
+	imm24 := uint32(v>>2) & 0xffffff
+	if typ == elf.R_ARM_CALL && is_thumb {
+		// BLX <label>, with the H bit for halfword alignment.
+		return 0xfa000000 | (uint32(v>>1)&1)<<24 | imm24, nil
+	}
+	if is_thumb {
+		return 0, fmt.Errorf("relocation %s against Thumb symbol '%s' "+
+			"needs a veneer", typ, c.Syms[file][rel.Sym].St_name)
+	}
+	if v&3 != 0 {
+		return 0, relocOverflow(c, file, rel, typ.String(), v)
+	}
+	if is_blx {
+		// BLX to an ARM function becomes a plain BL.
+		insn = 0xeb000000
+	}
+	return (insn & 0xff000000) | imm24, nil
+}
+
+func applyRelocARM(c *RelocContext, file int, rel elffile.Relocation,
+	sec []byte, P uint64) error {
+	typ := elf.R_ARM(rel.Type)
+	if typ == elf.R_ARM_NONE {
+		return nil
+	}
+	insn := c.read32(sec, rel.Offset)
+	A := rel.Addend
+	if !rel.HasAddend {
+		A = armImplicitAddend(typ, insn)
+	}
+	S := c.SymbolAddress(file, rel.Sym)
+	switch typ {
+	case elf.R_ARM_ABS32:
+		insn = uint32(S + uint64(A))
+	case elf.R_ARM_REL32:
+		insn = uint32(S + uint64(A) - P)
+	case elf.R_ARM_CALL, elf.R_ARM_JUMP24, elf.R_ARM_PLT32:
+		var err error
+		if insn, err = armBranch(c, file, rel, insn, S, A, P); err != nil {
+			return err
+		}
+	case elf.R_ARM_MOVW_ABS_NC:
+		insn = armSetMovImm(insn, uint32(S+uint64(A))&0xffff)
+	case elf.R_ARM_MOVT_ABS:
+		insn = armSetMovImm(insn, uint32((S+uint64(A))>>16)&0xffff)
+	case elf.R_ARM_PREL31:
+		// Used by .ARM.exidx. The top bit is left alone.
+		v := S + uint64(A) - P
+		if !fitsSigned(int64(v), 31) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		insn = (insn & 0x80000000) | (uint32(v) & 0x7fffffff)
+	case elf.R_ARM_V4BX:
+		// Marks a "BX Rm" so that it can be rewritten for ARMv4, which
+		// has no BX. NaCl requires ARMv7, so the BX is kept.
+		return nil
+	default:
+		return fmt.Errorf("unhandled ARM relocation type %s", typ)
+	}
+	c.write32(sec, rel.Offset, insn)
+	return nil
+}
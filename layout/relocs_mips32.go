@@ -0,0 +1,231 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Relocations for 32-bit MIPS (EM_MIPS, o32 ABI). These are REL-style.
+// A HI16 (or the GOT16 of a local symbol) only holds the upper half of its
+// addend, and the lower half comes from the LO16 that follows it.
+// GP-relative relocations are relative to _gp, which sits 0x7ff0 past the
+// start of the GOT so that signed 16-bit offsets can reach all of it.
+
+package layout
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+const (
+	SHT_MIPS_REGINFO = elf.SectionType(0x70000006)
+	// Size of Elf32_RegInfo: ri_gprmask, ri_cprmask[4], ri_gp_value.
+	mipsRegInfoSize = 24
+	// Offset of _gp from the start of the GOT.
+	MIPSGPOffset = 0x7ff0
+)
+
+func init() {
+	relocTargets[elf.EM_MIPS] = relocTarget{
+		gotEntSize:  4,
+		needsGOT:    needsGOTMIPS,
+		reserveGOT:  reserveGOTMIPS,
+		pairAddends: pairAddendsMIPS,
+		apply:       applyRelocMIPS}
+}
+
+func needsGOTMIPS(typ uint32) bool {
+	switch elf.R_MIPS(typ) {
+	case elf.R_MIPS_GOT16, elf.R_MIPS_CALL16:
+		return true
+	}
+	return false
+}
+
+func isLocalSym(c *RelocContext, file int, sym uint32) bool {
+	return elffile.St_bind(c.Syms[file][sym].St_info) == elf.STB_LOCAL
+}
+
+// Local symbols referenced by GOT16 get a page slot (paired with a LO16
+// for the rest of the address). Global ones get a normal slot.
+func reserveGOTMIPS(c *RelocContext, got *GOT, file int, rel elffile.Relocation) {
+	if !needsGOTMIPS(rel.Type) {
+		return
+	}
+	if elf.R_MIPS(rel.Type) == elf.R_MIPS_GOT16 &&
+		isLocalSym(c, file, rel.Sym) {
+		got.AddPage(SymRef{file, rel.Sym}, rel.Addend)
+		return
+	}
+	got.Add(c.Definition(file, rel.Sym))
+}
+
+func mipsLo16Addend(insn uint32) int64 {
+	return int64(int16(insn))
+}
+
+// Fill in the combined addend (AHL) of each HI16 and local GOT16 from
+// the next LO16 against the same symbol. Several HI16s may share a LO16.
+func pairAddendsMIPS(c *RelocContext, file int, rels []elffile.Relocation,
+	in []byte) {
+	for i := range rels {
+		rel := &rels[i]
+		typ := elf.R_MIPS(rel.Type)
+		if rel.HasAddend {
+			continue
+		}
+		if typ == elf.R_MIPS_LO16 {
+			rel.Addend = mipsLo16Addend(c.read32(in, rel.Offset))
+			rel.HasAddend = true
+			continue
+		}
+		if typ != elf.R_MIPS_HI16 &&
+			!(typ == elf.R_MIPS_GOT16 && isLocalSym(c, file, rel.Sym)) {
+			continue
+		}
+		ahl := int64(int32(c.read32(in, rel.Offset) << 16))
+		for j := i + 1; j < len(rels); j++ {
+			if elf.R_MIPS(rels[j].Type) == elf.R_MIPS_LO16 &&
+				rels[j].Sym == rel.Sym {
+				ahl += mipsLo16Addend(c.read32(in, rels[j].Offset))
+				break
+			}
+		}
+		rel.Addend = ahl
+		rel.HasAddend = true
+	}
+}
+
+// The GP value that the input file was compiled with (usually 0),
+// from its .reginfo.
+func mipsGP0(c *RelocContext, file int) int64 {
+	f := &c.Files[file]
+	for i := range f.Shdrs {
+		shdr := &f.Shdrs[i]
+		if shdr.Sh_type == SHT_MIPS_REGINFO && shdr.Sh_size >= mipsRegInfoSize {
+			return int64(int32(c.read32(f.Body[shdr.Sh_offset:], 20)))
+		}
+	}
+	return 0
+}
+
+// The value of _gp, normally defined by the layout.
+func mipsGP(c *RelocContext) uint64 {
+	if gp, ok := c.LinkerSyms["_gp"]; ok {
+		return gp
+	}
+	return c.GOT.Addr + MIPSGPOffset
+}
+
+func mipsSetImm16(insn uint32, v uint64) uint32 {
+	return (insn & 0xffff0000) | uint32(v&0xffff)
+}
+
+func applyRelocMIPS(c *RelocContext, file int, rel elffile.Relocation,
+	sec []byte, P uint64) error {
+	typ := elf.R_MIPS(rel.Type)
+	if typ == elf.R_MIPS_NONE || typ == elf.R_MIPS_JALR {
+		// JALR is only a hint that the jalr could be turned into a bal.
+		return nil
+	}
+	insn := c.read32(sec, rel.Offset)
+	A := rel.Addend
+	if !rel.HasAddend {
+		switch typ {
+		case elf.R_MIPS_26:
+			A = int64((insn & 0x3ffffff) << 2)
+		case elf.R_MIPS_GPREL16, elf.R_MIPS_GOT16, elf.R_MIPS_CALL16:
+			A = mipsLo16Addend(insn)
+		default:
+			A = int64(int32(insn))
+		}
+	}
+	S := c.SymbolAddress(file, rel.Sym)
+	is_gp_disp := c.Syms[file][rel.Sym].St_name == "_gp_disp"
+	switch typ {
+	case elf.R_MIPS_32:
+		insn = uint32(S + uint64(A))
+	case elf.R_MIPS_26:
+		var v uint64
+		if isLocalSym(c, file, rel.Sym) {
+			v = (uint64(A) | ((P + 4) & 0xf0000000)) + S
+		} else {
+			v = uint64(signExtend(uint64(A), 28)) + S
+		}
+		if (v & 0xf0000000) != ((P + 4) & 0xf0000000) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		insn = (insn & 0xfc000000) | uint32(v>>2)&0x3ffffff
+	case elf.R_MIPS_HI16:
+		v := S + uint64(A)
+		if is_gp_disp {
+			v = mipsGP(c) + uint64(A) - P
+		}
+		insn = mipsSetImm16(insn, (v+0x8000)>>16)
+	case elf.R_MIPS_LO16:
+		v := S + uint64(A)
+		if is_gp_disp {
+			// The LO16 is one instruction after the HI16, which
+			// was relative to the HI16.
+			v = mipsGP(c) + uint64(A) - P + 4
+		}
+		insn = mipsSetImm16(insn, v)
+	case elf.R_MIPS_GPREL16, elf.R_MIPS_GPREL32:
+		v := S + uint64(A) - mipsGP(c)
+		if isLocalSym(c, file, rel.Sym) {
+			v += uint64(mipsGP0(c, file))
+		}
+		if typ == elf.R_MIPS_GPREL32 {
+			insn = uint32(v)
+			break
+		}
+		if !fitsSigned(int64(v), 16) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		insn = mipsSetImm16(insn, v)
+	case elf.R_MIPS_GOT16, elf.R_MIPS_CALL16:
+		var slot uint64
+		if typ == elf.R_MIPS_GOT16 && isLocalSym(c, file, rel.Sym) {
+			slot = c.GOT.PageEntryAddr(SymRef{file, rel.Sym}, A)
+		} else {
+			slot = c.GOT.EntryAddr(c.Definition(file, rel.Sym))
+		}
+		v := slot - mipsGP(c)
+		if !fitsSigned(int64(v), 16) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		insn = mipsSetImm16(insn, v)
+	default:
+		return fmt.Errorf("unhandled MIPS relocation type %s", typ)
+	}
+	c.write32(sec, rel.Offset, insn)
+	return nil
+}
+
+// Combine the .reginfo of each input into the output .reginfo.
+// The register masks are OR'ed together, and ri_gp_value is the final _gp.
+func MergeMIPSRegInfo(files []elffile.ElfFile, gp uint64) []byte {
+	result := make([]byte, mipsRegInfoSize)
+	if len(files) == 0 {
+		return result
+	}
+	byte_order := elffile.ToByteOrder(files[0].Header.Data)
+	for i := range files {
+		f := &files[i]
+		for j := range f.Shdrs {
+			shdr := &f.Shdrs[j]
+			if shdr.Sh_type != SHT_MIPS_REGINFO ||
+				shdr.Sh_size < mipsRegInfoSize {
+				continue
+			}
+			in := f.Body[shdr.Sh_offset : shdr.Sh_offset+mipsRegInfoSize]
+			// ri_gprmask and the four ri_cprmask words.
+			for off := 0; off < 20; off += 4 {
+				mask := byte_order.Uint32(result[off:]) |
+					byte_order.Uint32(in[off:])
+				byte_order.PutUint32(result[off:], mask)
+			}
+		}
+	}
+	byte_order.PutUint32(result[20:], uint32(gp))
+	return result
+}
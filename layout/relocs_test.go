@@ -0,0 +1,506 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test applying relocations.
+
+package layout
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/jvoung/go-ld/archive"
+	"github.com/jvoung/go-ld/elffile"
+	. "github.com/jvoung/go-ld/internal/testutil"
+	. "github.com/jvoung/go-ld/internal/testutil/elftest"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+type relocTestLink struct {
+	files    []elffile.ElfFile
+	base     uint64
+	syms     []elffile.SymbolTable
+	ctx      RelocContext
+	sections InputSectionMap
+	// The relocations which couldn't be applied. The files are named
+	// file0, file1, etc.
+	errs []error
+}
+
+func readARMemberForTest(t *testing.T, ar_name string, member string) elffile.ElfFile {
+	buf, err := ioutil.ReadFile(ar_name)
+	if err != nil {
+		t.Fatal("Failed to read", ar_name, err)
+	}
+	ar_file, err := archive.ReadPlainARFile(bytes.NewReader(buf),
+		int64(len(buf)), ar_name)
+	AssertNoError(t, err)
+	contents, ok := ar_file.Member(member)
+	if !ok {
+		t.Fatal("No member", member, "in", ar_name)
+	}
+	return ReadElfFileForTest(contents.Contents)
+}
+
+// Stand-in for the real layout: place each allocated section of each file
+// one after the other starting at base, with the GOT at the end. Then
+// turn the symbol values into absolute addresses and apply relocations.
+func linkForRelocTest(files []elffile.ElfFile, base uint64) *relocTestLink {
+	l := &relocTestLink{files: files, base: base}
+	for i := range files {
+		l.syms = append(l.syms, ReadSymbolsForTest(files[i]))
+	}
+	link_info := resolver.ResolveSymbols(l.syms)
+	out := []byte{}
+	l.sections = make(InputSectionMap, len(files))
+	for i := range files {
+		f := &files[i]
+		l.sections[i] = make([]SectionPlacement, len(f.Shdrs))
+		for j := range f.Shdrs {
+			shdr := &f.Shdrs[j]
+			if shdr.Sh_flags&elf.SHF_ALLOC == 0 {
+				continue
+			}
+			for uint64(len(out))%16 != 0 {
+				out = append(out, 0)
+			}
+			l.sections[i][j] = SectionPlacement{
+				Placed: true,
+				Addr:   base + uint64(len(out)),
+				Offset: uint64(len(out))}
+			if shdr.Sh_type == elf.SHT_NOBITS {
+				out = append(out, make([]byte, shdr.Sh_size)...)
+			} else {
+				out = append(out, f.Body[shdr.Sh_offset:shdr.Sh_offset+shdr.Sh_size]...)
+			}
+		}
+	}
+	for i := range l.syms {
+		for k := range l.syms[i] {
+			sym := &l.syms[i][k]
+			shndx := int(sym.St_shndx)
+			if sym.St_shndx < elf.SHN_LORESERVE && l.sections.IsPlaced(i, shndx) {
+				sym.St_value += l.sections[i][shndx].Addr
+			}
+		}
+	}
+	got := ScanGOTRelocs(files, l.syms, link_info, l.sections)
+	for uint64(len(out))%16 != 0 {
+		out = append(out, 0)
+	}
+	got.Addr = base + uint64(len(out))
+	got.Offset = uint64(len(out))
+	out = append(out, make([]byte, got.Size())...)
+	l.ctx = RelocContext{
+		Files:      files,
+		Syms:       l.syms,
+		LinkInfo:   link_info,
+		Sections:   l.sections,
+		Out:        out,
+		ByteOrder:  elffile.ToByteOrder(files[0].Header.Data),
+		GOT:        got,
+		LinkerSyms: map[string]uint64{"_GLOBAL_OFFSET_TABLE_": got.Addr}}
+	names := make([]string, len(files))
+	for i := range names {
+		names[i] = fmt.Sprintf("file%d", i)
+	}
+	l.errs = l.ctx.ApplyRelocations(names)
+	l.ctx.FillGOT()
+	return l
+}
+
+func (l *relocTestLink) symAddr(t *testing.T, file int, name string) uint64 {
+	for k := range l.syms[file] {
+		if l.syms[file][k].St_name == name {
+			return l.syms[file][k].St_value
+		}
+	}
+	t.Fatal("No symbol named", name)
+	return 0
+}
+
+func (l *relocTestLink) sectionOf(t *testing.T, file int,
+	name string) SectionPlacement {
+	return l.sections[file][FindSectionIndexForTest(name, &l.files[file])]
+}
+
+// Read the 32-bit word at the given address.
+func (l *relocTestLink) word(addr uint64) uint32 {
+	return l.ctx.ByteOrder.Uint32(l.ctx.Out[addr-l.base:])
+}
+
+// The target of a pc-relative 32-bit field ending at addr+4.
+func (l *relocTestLink) pcrelTarget(addr uint64) uint64 {
+	return uint64(uint32(addr + 4 + uint64(int32(l.word(addr)))))
+}
+
+// Cross-file call from crtbegin.o to __pnacl_init_irt.
+func TestRelocsX8632Crtbegin(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "crtbegin.o")),
+		readARMemberForTest(t,
+			path.Join(TestX8632BaseDir(), "libcrt_platform.a"), "pnacl_irt.o")}
+	l := linkForRelocTest(files, 0x20000)
+	text := l.sectionOf(t, 0, ".text")
+	ExpectEq(t, l.symAddr(t, 1, "__pnacl_init_irt"),
+		l.pcrelTarget(text.Addr+0xbc))
+	// _pnacl_wrapper_start isn't defined, so it's left as 0.
+	ExpectEq(t, uint64(0), l.pcrelTarget(text.Addr+0xc4))
+}
+
+func TestRelocsX8632GOT(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_got.o"))}
+	l := linkForRelocTest(files, 0x8048000)
+	text := l.sectionOf(t, 0, ".text").Addr
+	got := l.ctx.GOT
+	// Only global_ptr, global_value and weak_missing go through the GOT.
+	ExpectEq(t, uint64(12), got.Size())
+
+	// R_386_PC32 to the pc thunk.
+	ExpectEq(t, l.symAddr(t, 0, "__x86.get_pc_thunk.ax"),
+		l.pcrelTarget(text+1))
+	// R_386_GOTPC: The thunk returns text+5 and the add makes that the GOT.
+	ExpectEq(t, got.Addr, uint64(uint32(text+5+uint64(l.word(text+6)))))
+	// R_386_GOT32: Load from the GOT slot, which has the address.
+	slot := got.Addr + uint64(l.word(text+0xc))
+	ExpectEq(t, uint32(l.symAddr(t, 0, "global_ptr")), l.word(slot))
+	slot = got.Addr + uint64(l.word(text+0x14))
+	ExpectEq(t, uint32(l.symAddr(t, 0, "global_value")), l.word(slot))
+	// R_386_GOTOFF to local_counter (.data + 4).
+	ExpectEq(t, l.symAddr(t, 0, "local_counter"),
+		uint64(uint32(got.Addr+uint64(l.word(text+0x2a)))))
+	ExpectEq(t, l.symAddr(t, 0, "local_counter"),
+		uint64(uint32(got.Addr+uint64(l.word(text+0x33)))))
+	// R_386_PLT32 calls go straight to the function.
+	ExpectEq(t, l.symAddr(t, 0, "GetGlobal"), l.pcrelTarget(text+0x49))
+	ExpectEq(t, l.symAddr(t, 0, "GetLocal"), l.pcrelTarget(text+0x50))
+	// The unresolved weak symbol's slot stays 0.
+	slot = got.Addr + uint64(l.word(text+0x6e))
+	ExpectEq(t, uint32(0), l.word(slot))
+	// R_386_32 in .data.rel.
+	ExpectEq(t, uint32(l.symAddr(t, 0, "global_value")),
+		l.word(l.sectionOf(t, 0, ".data.rel").Addr))
+}
+
+// Read the 64-bit word at the given address.
+func (l *relocTestLink) word64(addr uint64) uint64 {
+	return l.ctx.ByteOrder.Uint64(l.ctx.Out[addr-l.base:])
+}
+
+func (l *relocTestLink) byteAt(addr uint64) byte {
+	return l.ctx.Out[addr-l.base]
+}
+
+func TestRelocsX8664Crtbegin(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8664BaseDir(), "crtbegin.o")),
+		readARMemberForTest(t,
+			path.Join(TestX8664BaseDir(), "libcrt_platform.a"), "pnacl_irt.o")}
+	l := linkForRelocTest(files, 0x20000)
+	text := l.sectionOf(t, 0, ".text").Addr
+	// R_X86_64_32S against .text + 0xc0.
+	ExpectEq(t, uint32(text+0xc0), l.word(text+0xa4))
+	// R_X86_64_PC32 to the other file.
+	ExpectEq(t, l.symAddr(t, 1, "__pnacl_init_irt"), l.pcrelTarget(text+0xa9))
+}
+
+func TestRelocsX8664Overflow(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8664BaseDir(), "crtbegin.o"))}
+	l := linkForRelocTest(files, 0x100000000)
+	AssertEq(t, false, len(l.errs) == 0)
+	ExpectEqM(t, true, strings.Contains(l.errs[0].Error(),
+		"relocation R_X86_64_32S against"), l.errs[0].Error())
+	ExpectEqM(t, true, strings.HasPrefix(l.errs[0].Error(), "file0:(.text+0x"),
+		l.errs[0].Error())
+}
+
+func TestRelocsX8664GOT(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8664BaseDir(), "test_got.o"))}
+	l := linkForRelocTest(files, 0x400000)
+	text := l.sectionOf(t, 0, ".text").Addr
+	got := l.ctx.GOT
+	// R_X86_64_REX_GOTPCRELX: The movs are relaxed to leas.
+	ExpectEq(t, byte(0x8d), l.byteAt(text+0x1))
+	ExpectEq(t, l.symAddr(t, 0, "global_ptr"), l.pcrelTarget(text+0x3))
+	ExpectEq(t, byte(0x8d), l.byteAt(text+0xb))
+	ExpectEq(t, l.symAddr(t, 0, "global_value"), l.pcrelTarget(text+0xd))
+	// R_X86_64_PC32 to .data (local_counter).
+	ExpectEq(t, l.symAddr(t, 0, "local_counter"), l.pcrelTarget(text+0x18))
+	// R_X86_64_PLT32 calls go straight to the function.
+	ExpectEq(t, l.symAddr(t, 0, "GetGlobal"), l.pcrelTarget(text+0x28))
+	ExpectEq(t, l.symAddr(t, 0, "GetLocal"), l.pcrelTarget(text+0x2f))
+	// R_X86_64_GOTPCREL in a cmpq with an immediate after the field
+	// (addend -5), to the slot for the weak undefined symbol.
+	slot := l.pcrelTarget(text+0x3f) + 1
+	ExpectEq(t, uint64(0), l.word64(slot))
+	// Slots are handed out in relocation order, and the relaxed
+	// global_ptr and global_value still have theirs.
+	ExpectEq(t, got.Addr+16, slot)
+	// The weak undefined symbol's load can't be relaxed.
+	ExpectEq(t, byte(0x8b), l.byteAt(text+0x47))
+	ExpectEq(t, slot, l.pcrelTarget(text+0x49))
+	// R_X86_64_64 in .data.rel.
+	ExpectEq(t, l.symAddr(t, 0, "global_value"),
+		l.word64(l.sectionOf(t, 0, ".data.rel").Addr))
+}
+
+// The target of an ARM B / BL at the given address.
+func (l *relocTestLink) armBranchTarget(addr uint64) uint64 {
+	insn := l.word(addr)
+	return uint64(uint32(int64(addr) + 8 + signExtend(uint64(insn&0xffffff)<<2, 26)))
+}
+
+func (l *relocTestLink) armMovwMovt(addr uint64) uint32 {
+	return armMovImm(l.word(addr)) | armMovImm(l.word(addr+4))<<16
+}
+
+func TestRelocsARM(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestARMBaseDir(), "crtbegin.o")),
+		readARMemberForTest(t,
+			path.Join(TestARMBaseDir(), "libcrt_platform.a"), "pnacl_irt.o")}
+	l := linkForRelocTest(files, 0x20000)
+	text := l.sectionOf(t, 0, ".text").Addr
+	// R_ARM_CALL to the other file.
+	ExpectEq(t, l.symAddr(t, 1, "__pnacl_init_irt"),
+		l.armBranchTarget(text+0x6c))
+	ExpectEq(t, uint32(0xeb), l.word(text+0x6c)>>24)
+	// R_ARM_MOVW_ABS_NC / R_ARM_MOVT_ABS pair.
+	irt_text := l.sectionOf(t, 1, ".text").Addr
+	ExpectEq(t, uint32(l.symAddr(t, 1, "g_nacl_read_tp_func")),
+		l.armMovwMovt(irt_text+0x7c))
+}
+
+// Apply a single ARM relocation to the word, against a symbol
+// at the given address.
+func applyOneARM(typ elf.R_ARM, word uint32, S uint64, P uint64) uint32 {
+	result, err := applyOneARMWithError(typ, word, S, P)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func applyOneARMWithError(typ elf.R_ARM, word uint32, S uint64,
+	P uint64) (uint32, error) {
+	c := RelocContext{
+		Syms: []elffile.SymbolTable{{{},
+			{St_name: "sym", St_shndx: 1, St_value: S}}},
+		LinkInfo:  []resolver.SymLinkInfo{{}},
+		ByteOrder: elffile.ToByteOrder(elf.ELFDATA2LSB)}
+	sec := make([]byte, 4)
+	c.write32(sec, 0, word)
+	err := applyRelocARM(&c, 0, elffile.Relocation{Sym: 1, Type: uint32(typ)},
+		sec, P)
+	return c.read32(sec, 0), err
+}
+
+func TestRelocsARMEncodings(t *testing.T) {
+	// R_ARM_JUMP24: b<cond> with the usual -8 addend (0xfffffe).
+	ExpectEq(t, uint32(0x1a00003e),
+		applyOneARM(elf.R_ARM_JUMP24, 0x1afffffe, 0x20100, 0x20000))
+	// Backwards.
+	ExpectEq(t, uint32(0xeafffffe-0x40),
+		applyOneARM(elf.R_ARM_JUMP24, 0xeafffffe, 0x20000, 0x20100))
+	// R_ARM_CALL to Thumb code becomes a BLX, with the H bit set for
+	// the halfword offset.
+	ExpectEq(t, uint32(0xfb00003e),
+		applyOneARM(elf.R_ARM_CALL, 0xebfffffe, 0x20103, 0x20000))
+	// An existing BLX with the H bit set has an addend of -6, not -8.
+	ExpectEq(t, uint32(0xfa00003f),
+		applyOneARM(elf.R_ARM_CALL, 0xfbfffffe, 0x20103, 0x20000))
+	// And a BLX to ARM code becomes a BL.
+	ExpectEq(t, uint32(0xeb00003e),
+		applyOneARM(elf.R_ARM_CALL, 0xfafffffe, 0x20100, 0x20000))
+	// R_ARM_PREL31 keeps the top bit, and has an addend.
+	ExpectEq(t, uint32(0x80000104),
+		applyOneARM(elf.R_ARM_PREL31, 0x80000004, 0x20100, 0x20000))
+	ExpectEq(t, uint32(0x7fffff00),
+		applyOneARM(elf.R_ARM_PREL31, 0, 0x20000, 0x20100))
+	// R_ARM_REL32 and R_ARM_ABS32 use the whole word as the addend.
+	ExpectEq(t, uint32(0xfc),
+		applyOneARM(elf.R_ARM_REL32, 0xfffffffc, 0x20100, 0x20000))
+	ExpectEq(t, uint32(0x20104),
+		applyOneARM(elf.R_ARM_ABS32, 4, 0x20100, 0x20000))
+	// R_ARM_MOVW_ABS_NC / R_ARM_MOVT_ABS with an addend, e.g., sym+0x10
+	// for movw r0, #0x10 / movt r0, #0x10 (each has the whole addend).
+	ExpectEq(t, uint32(0xe3000110),
+		applyOneARM(elf.R_ARM_MOVW_ABS_NC, 0xe3000010, 0x12340100, 0))
+	ExpectEq(t, uint32(0xe3410234),
+		applyOneARM(elf.R_ARM_MOVT_ABS, 0xe3400010, 0x12340100, 0))
+	// R_ARM_V4BX leaves the bx lr alone.
+	ExpectEq(t, uint32(0xe12fff1e),
+		applyOneARM(elf.R_ARM_V4BX, 0xe12fff1e, 0, 0x20000))
+}
+
+func TestRelocsARMOutOfRange(t *testing.T) {
+	_, err := applyOneARMWithError(elf.R_ARM_CALL, 0xebfffffe, 0x4000000, 0)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "relocation R_ARM_CALL against 'sym' out of range: "+
+		"0x3fffff8", err.Error())
+	// A jump to Thumb code can't switch modes.
+	_, err = applyOneARMWithError(elf.R_ARM_JUMP24, 0xeafffffe, 0x20101,
+		0x20000)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "relocation R_ARM_JUMP24 against Thumb symbol 'sym' needs "+
+		"a veneer", err.Error())
+}
+
+func (l *relocTestLink) mipsImm16(addr uint64) int64 {
+	return int64(int16(l.word(addr)))
+}
+
+func TestRelocsMIPS(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestMIPSBaseDir(), "crtbegin.o")),
+		readARMemberForTest(t,
+			path.Join(TestMIPSBaseDir(), "libcrt_platform.a"), "pnacl_irt.o")}
+	l := linkForRelocTest(files, 0x20000)
+	gp := l.ctx.GOT.Addr + MIPSGPOffset
+	text := l.sectionOf(t, 0, ".text").Addr
+	// lui/addiu of _gp_disp gives the distance from the lui to _gp.
+	ExpectEq(t, gp-(text+0x50),
+		uint64(l.mipsImm16(text+0x50)<<16+l.mipsImm16(text+0x54)))
+	// R_MIPS_CALL16 loads the function address from the GOT.
+	slot := uint64(int64(gp) + l.mipsImm16(text+0x78))
+	ExpectEq(t, uint32(l.symAddr(t, 1, "__pnacl_init_irt")), l.word(slot))
+	// R_MIPS_GOT16 of a local symbol loads the page, and the LO16
+	// (a few instructions later) adds the rest.
+	irt_text := l.sectionOf(t, 1, ".text").Addr
+	slot = uint64(int64(gp) + l.mipsImm16(irt_text+0x6c))
+	ExpectEq(t, uint32(0), l.word(slot)&0xffff)
+	ExpectEq(t, l.symAddr(t, 1, "$.str"),
+		uint64(int64(l.word(slot))+l.mipsImm16(irt_text+0x9c)))
+	slot = uint64(int64(gp) + l.mipsImm16(irt_text+0xb4))
+	ExpectEq(t, l.symAddr(t, 1, "g_nacl_read_tp_func"),
+		uint64(int64(l.word(slot))+l.mipsImm16(irt_text+0xbc)))
+}
+
+// Apply MIPS relocations to a big-endian section against a global
+// symbol at the given address.
+func applyMIPSBigEndian(rels []elffile.Relocation, in []byte, S uint64,
+	base uint64, gp uint64) []byte {
+	c := RelocContext{
+		Files: []elffile.ElfFile{{}},
+		Syms: []elffile.SymbolTable{{{},
+			{St_name: "sym", St_shndx: 1, St_value: S,
+				St_info: uint8(elf.STB_GLOBAL) << 4}}},
+		LinkInfo:   []resolver.SymLinkInfo{{}},
+		ByteOrder:  elffile.ToByteOrder(elf.ELFDATA2MSB),
+		LinkerSyms: map[string]uint64{"_gp": gp}}
+	pairAddendsMIPS(&c, 0, rels, in)
+	sec := append([]byte{}, in...)
+	for _, rel := range rels {
+		applyRelocMIPS(&c, 0, rel, sec, base+rel.Offset)
+	}
+	return sec
+}
+
+func TestRelocsMIPSBigEndian(t *testing.T) {
+	in := []byte{
+		0x3c, 0x04, 0x00, 0x01, // lui a0, 0x1       (HI16, AHL = 0x8000)
+		0x3c, 0x05, 0x00, 0x01, // lui a1, 0x1       (HI16, same LO16)
+		0x24, 0x84, 0x80, 0x00, // addiu a0, a0, -0x8000  (LO16)
+		0x0c, 0x00, 0x00, 0x04, // jal 0x10          (26)
+		0x8f, 0x82, 0x00, 0x08, // lw v0, 8(gp)      (GPREL16)
+		0x00, 0x00, 0x00, 0x00} // .word             (GPREL32)
+	rels := []elffile.Relocation{
+		{Offset: 0, Sym: 1, Type: uint32(elf.R_MIPS_HI16)},
+		{Offset: 4, Sym: 1, Type: uint32(elf.R_MIPS_HI16)},
+		{Offset: 8, Sym: 1, Type: uint32(elf.R_MIPS_LO16)},
+		{Offset: 12, Sym: 1, Type: uint32(elf.R_MIPS_26)},
+		{Offset: 16, Sym: 1, Type: uint32(elf.R_MIPS_GPREL16)},
+		{Offset: 20, Sym: 1, Type: uint32(elf.R_MIPS_GPREL32)}}
+	sym := uint64(0x10007ff0)
+	gp := uint64(0x10008000)
+	out := applyMIPSBigEndian(rels, in, sym, 0x10000000, gp)
+	bo := elffile.ToByteOrder(elf.ELFDATA2MSB)
+	// sym + 0x8000 = 0x1000fff0, so %hi = 0x1001 and %lo = -0x10.
+	ExpectEq(t, uint32(0x3c041001), bo.Uint32(out[0:]))
+	ExpectEq(t, uint32(0x3c051001), bo.Uint32(out[4:]))
+	ExpectEq(t, uint32(0x2484fff0), bo.Uint32(out[8:]))
+	// jal to sym + 0x10.
+	ExpectEq(t, uint32(0x0c000000|(uint32(sym+0x10)>>2)&0x3ffffff),
+		bo.Uint32(out[12:]))
+	// GPREL: sym + 8 - gp.
+	ExpectEq(t, uint32(0x8f82fff8), bo.Uint32(out[16:]))
+	ExpectEq(t, uint32(sym-gp), bo.Uint32(out[20:]))
+
+	// sym + 0x8000 = 0x10008000 has a negative %lo, so the %hi has to
+	// carry: 0x10010000 - 0x8000.
+	out = applyMIPSBigEndian(rels[:3], in[:12], 0x10000000, 0x10000000, gp)
+	ExpectEq(t, uint32(0x3c041001), bo.Uint32(out[0:]))
+	ExpectEq(t, uint32(0x24848000), bo.Uint32(out[8:]))
+}
+
+func TestMergeMIPSRegInfo(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestMIPSBaseDir(), "crtbegin.o")),
+		ReadElfFileFname(path.Join(TestMIPSBaseDir(), "crtend.o"))}
+	reginfo := MergeMIPSRegInfo(files, 0x10037ff0)
+	AssertEq(t, mipsRegInfoSize, len(reginfo))
+	bo := elffile.ToByteOrder(files[0].Header.Data)
+	ExpectEq(t, uint32(0x10037ff0), bo.Uint32(reginfo[20:]))
+	// The gprmask is the union of the inputs.
+	var mask uint32
+	for i := range files {
+		shdr := files[i].Shdrs[FindSectionIndexForTest(".reginfo", &files[i])]
+		mask |= bo.Uint32(files[i].Body[shdr.Sh_offset:])
+	}
+	ExpectEq(t, mask, bo.Uint32(reginfo))
+}
+
+func symbolIndexForTest(t *testing.T, st elffile.SymbolTable, name string) uint32 {
+	for k := range st {
+		if st[k].St_name == name {
+			return uint32(k)
+		}
+	}
+	t.Fatal("No symbol", name)
+	return 0
+}
+
+// A strong definition overrides a weak one, even for the references
+// from the file with the weak one, and unresolved weak references are 0.
+func TestResolveSymbolsWeak(t *testing.T) {
+	main_obj := ReadElfFileFname(path.Join(TestX8632BaseDir(),
+		"test_weak_main.o"))
+	strong := ReadElfFileFname(path.Join(TestX8632BaseDir(),
+		"test_weak_strong.o"))
+	// The weak definition may come first or second.
+	for main_index := 0; main_index < 2; main_index++ {
+		strong_index := 1 - main_index
+		files := make([]elffile.ElfFile, 2)
+		files[main_index] = main_obj
+		files[strong_index] = strong
+		f_syms := []elffile.SymbolTable{ReadSymbolsForTest(files[0]),
+			ReadSymbolsForTest(files[1])}
+		c := RelocContext{Files: files, Syms: f_syms,
+			LinkInfo: resolver.ResolveSymbols(f_syms)}
+		main_syms := f_syms[main_index]
+		def := c.Definition(main_index,
+			symbolIndexForTest(t, main_syms, "overridden"))
+		ExpectEq(t, SymRef{strong_index,
+			symbolIndexForTest(t, f_syms[strong_index], "overridden")}, def)
+
+		missing := symbolIndexForTest(t, main_syms, "maybe_missing")
+		ExpectEq(t, SymRef{main_index, missing}, c.Definition(main_index,
+			missing))
+		ExpectEq(t, uint64(0), c.SymbolAddress(main_index, missing))
+	}
+
+	// With only the weak definition, that is used.
+	f_syms := []elffile.SymbolTable{ReadSymbolsForTest(main_obj)}
+	c := RelocContext{Files: []elffile.ElfFile{main_obj}, Syms: f_syms,
+		LinkInfo: resolver.ResolveSymbols(f_syms)}
+	overridden := symbolIndexForTest(t, f_syms[0], "overridden")
+	ExpectEq(t, SymRef{0, overridden}, c.Definition(0, overridden))
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Relocations for x86-32 (EM_386). These are all REL-style, with the
+// implicit addend stored in the 32-bit word being patched.
+
+package layout
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+func init() {
+	relocTargets[elf.EM_386] = relocTarget{
+		gotEntSize: 4,
+		needsGOT:   needsGOTX8632,
+		apply:      applyRelocX8632}
+}
+
+func needsGOTX8632(typ uint32) bool {
+	switch elf.R_386(typ) {
+	case elf.R_386_GOT32, elf.R_386_GOT32X:
+		return true
+	}
+	return false
+}
+
+// Whether the ModRM byte before the place (of a mov or other instruction
+// using the GOT32X slot) has a base register. Without a base register,
+// the place holds the absolute address of the GOT slot instead of an
+// offset from the GOT.
+func hasBaseRegX8632(sec []byte, off uint64) bool {
+	if off < 1 {
+		return true
+	}
+	modrm := sec[off-1]
+	return !(modrm>>6 == 0 && modrm&7 == 5)
+}
+
+func applyRelocX8632(c *RelocContext, file int, rel elffile.Relocation,
+	sec []byte, P uint64) error {
+	A := rel.Addend
+	if !rel.HasAddend {
+		A = int64(int32(c.read32(sec, rel.Offset)))
+	}
+	S := c.SymbolAddress(file, rel.Sym)
+	var GOT uint64
+	if c.GOT != nil {
+		GOT = c.GOT.Addr
+	}
+	var v uint64
+	switch elf.R_386(rel.Type) {
+	case elf.R_386_NONE:
+		return nil
+	case elf.R_386_32:
+		v = S + uint64(A)
+	case elf.R_386_PC32:
+		v = S + uint64(A) - P
+	case elf.R_386_PLT32:
+		// Static link: there is no PLT, so call the function directly.
+		v = S + uint64(A) - P
+	case elf.R_386_GOTPC:
+		v = GOT + uint64(A) - P
+	case elf.R_386_GOTOFF:
+		v = S + uint64(A) - GOT
+	case elf.R_386_GOT32, elf.R_386_GOT32X:
+		slot := c.GOT.EntryAddr(c.Definition(file, rel.Sym))
+		v = slot + uint64(A)
+		if elf.R_386(rel.Type) == elf.R_386_GOT32 ||
+			hasBaseRegX8632(sec, rel.Offset) {
+			v -= GOT
+		}
+	default:
+		return fmt.Errorf("unhandled x86-32 relocation type %s",
+			elf.R_386(rel.Type))
+	}
+	c.write32(sec, rel.Offset, uint32(v))
+	return nil
+}
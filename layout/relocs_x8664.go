@@ -0,0 +1,128 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Relocations for x86-64 (EM_X86_64). These are RELA-style, with the
+// addend in the Elf64Rela entry.
+
+package layout
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+func init() {
+	relocTargets[elf.EM_X86_64] = relocTarget{
+		gotEntSize: 8,
+		needsGOT:   needsGOTX8664,
+		apply:      applyRelocX8664}
+}
+
+// The GOTPCRELX types are given a GOT slot too, in case the instruction
+// can't be relaxed.
+func needsGOTX8664(typ uint32) bool {
+	switch elf.R_X86_64(typ) {
+	case elf.R_X86_64_GOTPCREL, elf.R_X86_64_GOTPCRELX,
+		elf.R_X86_64_REX_GOTPCRELX:
+		return true
+	}
+	return false
+}
+
+// Try to turn a load from the GOT into a direct reference, since
+// everything is defined within the static executable:
+//
+//	mov foo@GOTPCREL(%rip), %reg  ->  lea foo(%rip), %reg
+//	call *foo@GOTPCREL(%rip)      ->  addr32 call foo
+//	jmp *foo@GOTPCREL(%rip)       ->  jmp foo; nop
+//
+// Returns false if the instruction isn't one of those, or the
+// symbol is too far away.
+func relaxGOTPCRELX8664(c *RelocContext, file int, rel elffile.Relocation,
+	sec []byte, P uint64) bool {
+	if rel.Offset < 2 {
+		return false
+	}
+	def := c.Definition(file, rel.Sym)
+	if c.Syms[def.File][def.Sym].St_shndx == elf.SHN_UNDEF {
+		// Leave undefined (weak) symbols alone, since 0 may not be reachable.
+		return false
+	}
+	v := int64(c.SymbolAddress(file, rel.Sym) + uint64(rel.Addend) - P)
+	if !fitsSigned(v, 32) {
+		return false
+	}
+	op := sec[rel.Offset-2]
+	modrm := sec[rel.Offset-1]
+	switch {
+	case op == 0x8b:
+		sec[rel.Offset-2] = 0x8d
+	case op == 0xff && modrm == 0x15:
+		sec[rel.Offset-2] = 0x67
+		sec[rel.Offset-1] = 0xe8
+	case op == 0xff && modrm == 0x25:
+		// The jmp is one byte shorter, so the nop goes at the end.
+		// The addend is relative to the end of the original instruction,
+		// so adjust for the place moving back one byte.
+		if rel.Offset+4 > uint64(len(sec)) {
+			return false
+		}
+		sec[rel.Offset-2] = 0xe9
+		c.write32(sec, rel.Offset-1, uint32(v+1))
+		sec[rel.Offset+3] = 0x90
+		return true
+	default:
+		return false
+	}
+	c.write32(sec, rel.Offset, uint32(v))
+	return true
+}
+
+func applyRelocX8664(c *RelocContext, file int, rel elffile.Relocation,
+	sec []byte, P uint64) error {
+	A := uint64(rel.Addend)
+	S := c.SymbolAddress(file, rel.Sym)
+	typ := elf.R_X86_64(rel.Type)
+	switch typ {
+	case elf.R_X86_64_NONE:
+		return nil
+	case elf.R_X86_64_64:
+		c.write64(sec, rel.Offset, S+A)
+	case elf.R_X86_64_PC32, elf.R_X86_64_PLT32:
+		// Static link: there is no PLT, so call the function directly.
+		v := S + A - P
+		if !fitsSigned(int64(v), 32) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		c.write32(sec, rel.Offset, uint32(v))
+	case elf.R_X86_64_32:
+		v := S + A
+		if !fitsUnsigned(v, 32) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		c.write32(sec, rel.Offset, uint32(v))
+	case elf.R_X86_64_32S:
+		v := S + A
+		if !fitsSigned(int64(v), 32) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		c.write32(sec, rel.Offset, uint32(v))
+	case elf.R_X86_64_GOTPCRELX, elf.R_X86_64_REX_GOTPCRELX,
+		elf.R_X86_64_GOTPCREL:
+		if typ != elf.R_X86_64_GOTPCREL &&
+			relaxGOTPCRELX8664(c, file, rel, sec, P) {
+			return nil
+		}
+		slot := c.GOT.EntryAddr(c.Definition(file, rel.Sym))
+		v := slot + A - P
+		if !fitsSigned(int64(v), 32) {
+			return relocOverflow(c, file, rel, typ.String(), v)
+		}
+		c.write32(sec, rel.Offset, uint32(v))
+	default:
+		return fmt.Errorf("unhandled x86-64 relocation type %s", typ)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Find the undefined symbols: each relocation against a symbol which
+// no file (nor the linker) defines is an "undefined reference".
+// Weak undefined references are fine, and resolve to 0.
+
+package layout
+
+import (
+	"debug/elf"
+	"fmt"
+
+	"github.com/jvoung/go-ld/elffile"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+// A relocation against an undefined symbol: in section Section of file
+// File (an object, or archive(member)), at Offset into the section.
+// Function is the nearest function symbol before the relocation, if any.
+type UndefinedReference struct {
+	Symbol   string
+	File     string
+	Section  string
+	Offset   uint64
+	Function string
+}
+
+func (u UndefinedReference) String() string {
+	where := fmt.Sprintf("%s:(%s+0x%x)", u.File, u.Section, u.Offset)
+	if u.Function != "" {
+		where += fmt.Sprintf(": in function '%s'", u.Function)
+	}
+	return fmt.Sprintf("%s: undefined reference to '%s'", where, u.Symbol)
+}
+
+// Whether the relocation's symbol is undefined everywhere (and not
+// weak, and not defined by the linker).
+func (c *RelocContext) isUndefinedReference(file int, sym uint32) bool {
+	if sym == 0 {
+		return false
+	}
+	ref := &c.Syms[file][sym]
+	def := c.Definition(file, sym)
+	def_entry := &c.Syms[def.File][def.Sym]
+	if ref.St_shndx != elf.SHN_UNDEF || def_entry.St_shndx != elf.SHN_UNDEF ||
+		resolver.IsWeakSym(ref) {
+		return false
+	}
+	_, ok := c.LinkerSyms[ref.St_name]
+	return !ok
+}
+
+// The function symbol of the file which is closest before the address,
+// within section shndx, or "" if there isn't one. Symbol values are
+// expected to already be absolute addresses (see DoLayout).
+func (c *RelocContext) functionBefore(file int, shndx int,
+	addr uint64) string {
+	name := ""
+	var best uint64
+	for k := range c.Syms[file] {
+		st_entry := &c.Syms[file][k]
+		if sym_shndx, ok := st_entry.Section(); !ok || sym_shndx != shndx ||
+			elf.ST_TYPE(st_entry.St_info) != elf.STT_FUNC ||
+			st_entry.St_value > addr {
+			continue
+		}
+		if name == "" || st_entry.St_value > best {
+			name = st_entry.St_name
+			best = st_entry.St_value
+		}
+	}
+	return name
+}
+
+// Find the undefined references in the placed sections, in file and
+// relocation order. The names are the names of the files, for the
+// diagnostics.
+func (c *RelocContext) UndefinedReferences(names []string) []UndefinedReference {
+	refs := []UndefinedReference{}
+	for i := range c.Files {
+		f := &c.Files[i]
+		target := getRelocTarget(f.Header.Machine)
+		for j := range f.Shdrs {
+			shdr := &f.Shdrs[j]
+			target_index := int(shdr.Sh_info)
+			if !elffile.IsRelocSection(shdr) || !c.Sections.IsPlaced(i, target_index) {
+				continue
+			}
+			for _, rel := range readRelocsForTarget(c, target, i, j) {
+				if !c.isUndefinedReference(i, rel.Sym) {
+					continue
+				}
+				addr := c.Sections[i][target_index].Addr + rel.Offset
+				refs = append(refs, UndefinedReference{
+					Symbol:   c.Syms[i][rel.Sym].St_name,
+					File:     names[i],
+					Section:  f.Shdrs[target_index].Sh_name,
+					Offset:   rel.Offset,
+					Function: c.functionBefore(i, target_index, addr)})
+			}
+		}
+	}
+	return refs
+}
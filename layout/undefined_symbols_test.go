@@ -0,0 +1,43 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test the undefined symbol diagnostics.
+
+package layout
+
+import (
+	"path"
+	"testing"
+
+	"github.com/jvoung/go-ld/elffile"
+	. "github.com/jvoung/go-ld/internal/testutil"
+	. "github.com/jvoung/go-ld/internal/testutil/elftest"
+	"github.com/jvoung/go-ld/resolver"
+)
+
+func TestUndefinedReferences(t *testing.T) {
+	files := []elffile.ElfFile{
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_undefined.o")),
+		ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_got.o"))}
+	f_syms := []elffile.SymbolTable{ReadSymbolsForTest(files[0]),
+		ReadSymbolsForTest(files[1])}
+	link_info := resolver.ResolveSymbols(f_syms)
+	layout, err := DoLayout(f_syms, files, link_info, LayoutOptions{})
+	AssertNoError(t, err)
+	c := RelocContext{Files: files, Syms: f_syms, LinkInfo: link_info,
+		Sections: layout.Sections, LinkerSyms: layout.LinkerSyms}
+	refs := c.UndefinedReferences([]string{"libu.a(test_undefined.o)",
+		"test_got.o"})
+	// The weak reference to maybe_missing is fine.
+	expected := []UndefinedReference{
+		{"missing_func", "libu.a(test_undefined.o)", ".text", 0x4, "helper"},
+		{"missing_var", "libu.a(test_undefined.o)", ".text", 0x23,
+			"undefined_main"}}
+	AssertEq(t, len(expected), len(refs))
+	for i := range expected {
+		ExpectEq(t, expected[i], refs[i])
+	}
+	ExpectEq(t, "libu.a(test_undefined.o):(.text+0x23): in function "+
+		"'undefined_main': undefined reference to 'missing_var'",
+		refs[1].String())
+}
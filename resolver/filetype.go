@@ -3,17 +3,14 @@
 
 // Simple file-type detection utilities for ELF linker.
 
-package main
+package resolver
 
 import (
 	"os"
 	"strings"
-)
 
-const (
-	AR_MAGIC = "!<arch>\n"
-	THIN_AR_MAGIC = "!<thin>\n"
-	ELF_MAGIC = "\x7fELF"
+	"github.com/jvoung/go-ld/archive"
+	"github.com/jvoung/go-ld/elffile"
 )
 
 type FileType int
@@ -32,25 +29,27 @@ func (t FileType) String() string {
 	}
 }
 
-func ValidateFiles(files map[string] *os.File) map[string]FileType {
+// Determine the type of each file, failing if any of them isn't an
+// ELF file or archive.
+func ValidateFiles(files map[string] *os.File) (map[string]FileType, error) {
 	types := make(map[string]FileType, len(files))
 	for fname, f := range files {
 		sniff_amt := 8
 		buf := make([]byte, sniff_amt)
 		n, err := f.ReadAt(buf, 0)
 		if err != nil || n != sniff_amt {
-			panic("Unable to read file: " + fname + " w/ err: " + err.Error())
+			return nil, elffile.FileError(fname, "cannot read file: %s", err)
 		}
 		magic := string(buf)
-		if strings.HasPrefix(magic, ELF_MAGIC) {
+		if strings.HasPrefix(magic, elffile.ELF_MAGIC) {
 			types[fname] = ELF_FILE
-		} else if strings.HasPrefix(magic, AR_MAGIC) {
+		} else if strings.HasPrefix(magic, archive.AR_MAGIC) {
 			types[fname] = AR_FILE
-		} else if strings.HasPrefix(magic, THIN_AR_MAGIC) {
+		} else if strings.HasPrefix(magic, archive.THIN_AR_MAGIC) {
 			types[fname] = THIN_AR_FILE
 		} else {
-			panic("File: " + fname + " is not ELF or .a file")
+			return nil, elffile.FileError(fname, "not an ELF file or archive")
 		}
 	}
-	return types
+	return types, nil
 }
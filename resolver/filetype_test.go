@@ -3,12 +3,14 @@
 
 // Test for file-type detection utilities for ELF linker.
 
-package main
+package resolver
 
 import (
 	"os"
 	"path"
 	"testing"
+
+	. "github.com/jvoung/go-ld/internal/testutil"
 )
 
 func CheckFiles(t *testing.T, fnames []string, expected FileType) {
@@ -22,7 +24,8 @@ func CheckFiles(t *testing.T, fnames []string, expected FileType) {
 		fhandles[fname] = f
 	}
 	
-	file_map := ValidateFiles(fhandles)
+	file_map, err := ValidateFiles(fhandles)
+	AssertNoError(t, err)
 	for fname, typ := range file_map {
 		ExpectEqM(t, expected, typ, fname + "should be")
 	}
@@ -61,6 +64,7 @@ func TestELFFile(t *testing.T) {
 }
 
 func TestThinARFile(t *testing.T) {
-	fnames := []string{path.Join(TestX8632BaseDir(), "libthin_all.a")}
+	fnames := []string{path.Join(TestX8632BaseDir(), "libthin_all.a"),
+		path.Join(TestX8632BaseDir(), "libthin_nested.a")}
 	CheckFiles(t, fnames, THIN_AR_FILE)
 }
@@ -0,0 +1,116 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// The global symbol table: one name -> definition table for all the
+// files being linked, instead of searching each file for each undefined
+// symbol. The definitions of each object are found when it is read (in
+// parallel with the other inputs), and then merged into the table in
+// link order once the archive members are picked. Symbol names are
+// interned so that each name is only stored once, however many files
+// refer to it.
+
+package resolver
+
+import (
+	"debug/elf"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+// A definition in the table, and how strongly it overrides others.
+type globalDefinition struct {
+	def  Resolver
+	rank int
+}
+
+// Whether definition a is picked over definition b. Definitions of the
+// same rank are picked in file (and symbol) order, so the result does
+// not depend on the order that the files are added in.
+func (a globalDefinition) overrides(b globalDefinition) bool {
+	if a.rank != b.rank {
+		return a.rank > b.rank
+	}
+	if a.def.DefFileIndex != b.def.DefFileIndex {
+		return a.def.DefFileIndex < b.def.DefFileIndex
+	}
+	return a.def.DefSymIndex < b.def.DefSymIndex
+}
+
+// The global symbols of one object, and which of them are definitions
+// (with their ranks), ready to be added to a GlobalSymbols. This doesn't
+// depend on the other files, so it is made as the object is read.
+type FileDefinitions struct {
+	globals []int
+	defs    []fileDefinition
+}
+
+type fileDefinition struct {
+	sym  int
+	rank int
+}
+
+// Find the global symbols and definitions of an object's symbols.
+func NewFileDefinitions(syms elffile.SymbolTable) FileDefinitions {
+	var f FileDefinitions
+	for k := 1; k < len(syms); k++ {
+		sym := &syms[k]
+		if !isGlobalSym(sym) {
+			continue
+		}
+		f.globals = append(f.globals, k)
+		if sym.St_shndx != elf.SHN_UNDEF {
+			f.defs = append(f.defs, fileDefinition{k, definitionRank(sym)})
+		}
+	}
+	return f
+}
+
+// The definition of each global symbol name, from all the files.
+// The files are merged in one pass, once the archive members which are
+// linked in (and so the file indices) are known.
+type GlobalSymbols struct {
+	names       map[string]string
+	definitions map[string]globalDefinition
+}
+
+func NewGlobalSymbols() *GlobalSymbols {
+	return &GlobalSymbols{names: make(map[string]string),
+		definitions: make(map[string]globalDefinition)}
+}
+
+// Return the one copy of the name.
+func (g *GlobalSymbols) Intern(name string) string {
+	if interned, ok := g.names[name]; ok {
+		return interned
+	}
+	g.names[name] = name
+	return name
+}
+
+// Add the definitions of file number file (its index in the link), from
+// NewFileDefinitions(syms), and intern the names of its global symbols
+// (in place). The definitions are ranked as in ResolveSymbols.
+func (g *GlobalSymbols) AddFile(file int, syms elffile.SymbolTable,
+	f FileDefinitions) {
+	for _, k := range f.globals {
+		syms[k].St_name = g.Intern(syms[k].St_name)
+	}
+	for _, d := range f.defs {
+		name := syms[d.sym].St_name
+		def := globalDefinition{Resolver{file, d.sym}, d.rank}
+		if prev, ok := g.definitions[name]; !ok || def.overrides(prev) {
+			g.definitions[name] = def
+		}
+	}
+}
+
+// The definition of the symbol, if any file defines it.
+func (g *GlobalSymbols) Lookup(name string) (Resolver, bool) {
+	def, ok := g.definitions[name]
+	return def.def, ok
+}
+
+// The number of symbols with a definition.
+func (g *GlobalSymbols) Len() int {
+	return len(g.definitions)
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test the global symbol table, and benchmark symbol resolution.
+
+package resolver
+
+import (
+	"debug/elf"
+	"fmt"
+	"testing"
+
+	"github.com/jvoung/go-ld/elffile"
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func globalSymForTest(name string, bind elf.SymBind,
+	shndx elf.SectionIndex) elffile.SymbolTableEntry {
+	return elffile.SymbolTableEntry{St_name: name,
+		St_info:  uint8(bind)<<4 | uint8(elf.STT_FUNC),
+		St_shndx: shndx}
+}
+
+// The definitions picked don't depend on the order the files are
+// added in.
+func TestGlobalSymbols(t *testing.T) {
+	f_syms := []elffile.SymbolTable{
+		{{}, globalSymForTest("weak_then_strong", elf.STB_WEAK, 1),
+			globalSymForTest("first", elf.STB_GLOBAL, 1),
+			globalSymForTest("common_then_strong", elf.STB_GLOBAL,
+				elf.SHN_COMMON)},
+		{{}, globalSymForTest("first", elf.STB_GLOBAL, 1),
+			globalSymForTest("undefined", elf.STB_GLOBAL, elf.SHN_UNDEF),
+			globalSymForTest("local", elf.STB_LOCAL, 1)},
+		{{}, globalSymForTest("common_then_strong", elf.STB_GLOBAL, 2),
+			globalSymForTest("weak_then_strong", elf.STB_GLOBAL, 1)}}
+	expected := map[string]Resolver{
+		"weak_then_strong":   {2, 2},
+		"first":              {0, 2},
+		"common_then_strong": {2, 1}}
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		g := NewGlobalSymbols()
+		for _, file := range order {
+			g.AddFile(file, f_syms[file], NewFileDefinitions(f_syms[file]))
+		}
+		ExpectEqM(t, len(expected), g.Len(), fmt.Sprint(order))
+		for name, def := range expected {
+			found, ok := g.Lookup(name)
+			ExpectEqM(t, true, ok, name)
+			ExpectEqM(t, def, found, name)
+		}
+		for _, name := range []string{"undefined", "local"} {
+			_, ok := g.Lookup(name)
+			ExpectEqM(t, false, ok, name)
+		}
+		ExpectEq(t, "first", g.Intern(string([]byte("first"))))
+	}
+}
+
+// Synthetic objects: each defines syms_per_file functions, and calls
+// the functions of the next file.
+func syntheticObjectsForTest(files int, syms_per_file int) []elffile.SymbolTable {
+	f_syms := make([]elffile.SymbolTable, files)
+	for i := range f_syms {
+		syms := make(elffile.SymbolTable, 1, 1+2*syms_per_file)
+		for j := 0; j < syms_per_file; j++ {
+			syms = append(syms,
+				globalSymForTest(fmt.Sprintf("f%d_%d", i, j), elf.STB_GLOBAL, 1),
+				globalSymForTest(fmt.Sprintf("f%d_%d", (i+1)%files, j),
+					elf.STB_GLOBAL, elf.SHN_UNDEF))
+		}
+		f_syms[i] = syms
+	}
+	return f_syms
+}
+
+// The old way to resolve symbols: search every other file for each
+// undefined symbol, which is quadratic in the number of files.
+func resolveSymbolsByScanForTest(f_syms []elffile.SymbolTable) []SymLinkInfo {
+	imports_exports := make([]SymLinkInfo, 0, len(f_syms))
+	for _, syms := range f_syms {
+		imports_exports = append(imports_exports, GetSymLinkInfo(syms))
+	}
+	for cur_file, ie := range imports_exports {
+		for undef_index := range ie.UndefinedSyms {
+			sym_name := f_syms[cur_file][undef_index].St_name
+			for other_file, other_ie := range imports_exports {
+				if other_file == cur_file {
+					continue
+				}
+				if def_index, ok := other_ie.ExportedSymHash[sym_name]; ok {
+					ie.UndefinedSyms[undef_index] = Resolver{other_file, def_index}
+				}
+			}
+		}
+	}
+	return imports_exports
+}
+
+func TestResolveSyntheticObjects(t *testing.T) {
+	f_syms := syntheticObjectsForTest(10, 5)
+	link_info := ResolveSymbols(f_syms)
+	scanned := resolveSymbolsByScanForTest(syntheticObjectsForTest(10, 5))
+	for i := range link_info {
+		AssertEq(t, len(scanned[i].UndefinedSyms),
+			len(link_info[i].UndefinedSyms))
+		for k, def := range scanned[i].UndefinedSyms {
+			ExpectEq(t, def, link_info[i].UndefinedSyms[k])
+		}
+	}
+}
+
+func benchmarkResolve(b *testing.B,
+	resolve func([]elffile.SymbolTable) []SymLinkInfo) {
+	for _, files := range []int{10, 100, 1000} {
+		f_syms := syntheticObjectsForTest(files, 50)
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				resolve(f_syms)
+			}
+		})
+	}
+}
+
+// Compare with BenchmarkResolveSymbolsByScan: the time per file stays
+// about the same as the number of files grows.
+func BenchmarkResolveSymbols(b *testing.B) {
+	benchmarkResolve(b, ResolveSymbols)
+}
+
+func BenchmarkResolveSymbolsByScan(b *testing.B) {
+	benchmarkResolve(b, resolveSymbolsByScanForTest)
+}
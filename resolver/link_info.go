@@ -0,0 +1,71 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Which symbols each file defines and needs, and where the needed
+// symbols are defined.
+
+package resolver
+
+import (
+	"debug/elf"
+
+	"github.com/jvoung/go-ld/elffile"
+)
+
+// Set of symbol table indices.
+type IndexSet map[int]bool
+
+// An undefined symbol is from fileA and resolves to a defined
+// symbol in fileB. Represent fileB with an int and the other symbol
+// with another int.
+type Resolver struct {
+	DefFileIndex int
+	DefSymIndex  int
+}
+type UndefResolveMap map[int]Resolver
+
+type SymLinkInfo struct {
+	// Index into symbol table for the symbol.
+	// These are sets (but use a map to represent that).
+	UndefinedSyms UndefResolveMap
+	// The global (and weak) definitions.
+	ExportedSyms    IndexSet
+	ExportedSymHash map[string]int
+	// Definitions which are overridden by the definition in another
+	// file (e.g., a weak definition by a strong one), and that definition.
+	OverriddenSyms UndefResolveMap
+}
+
+func GetSymLinkInfo(st elffile.SymbolTable) SymLinkInfo {
+	info := SymLinkInfo{make(map[int]Resolver, 0),
+		make(map[int]bool, 0),
+		make(map[string]int, 0),
+		make(map[int]Resolver, 0)}
+	for i, sym := range st {
+		// Symbol at index 0 is always UNDEF and w/out a name.
+		if i == 0 {
+			continue
+		}
+		if sym.St_shndx == elf.SHN_UNDEF {
+			info.UndefinedSyms[i] = Resolver{}
+		} else if elffile.GetSymBind(sym.St_info) != elf.STB_LOCAL {
+			info.ExportedSyms[i] = true
+			info.ExportedSymHash[sym.St_name] = i
+		}
+	}
+	return info
+}
+
+func SymLinkInfoToHash(link_info SymLinkInfo,
+	st elffile.SymbolTable) map[string]*elffile.SymbolTableEntry {
+	result := make(map[string]*elffile.SymbolTableEntry)
+	// UndefinedSyms and ExportedSyms should be unique and not have
+	// local symbols, so we can use a map[string] at this point.
+	for index := range link_info.UndefinedSyms {
+		result[st[index].St_name] = &st[index]
+	}
+	for index := range link_info.ExportedSyms {
+		result[st[index].St_name] = &st[index]
+	}
+	return result
+}
@@ -0,0 +1,493 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Determine which file resolves the undef symbols of another (required) file.
+
+package resolver
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jvoung/go-ld/archive"
+	"github.com/jvoung/go-ld/elffile"
+)
+
+// Resolve the undefined symbols of each file to their definitions,
+// through a GlobalSymbols table of all the files' definitions.
+func ResolveSymbols(f_syms []elffile.SymbolTable) []SymLinkInfo {
+	f_defs := make([]FileDefinitions, len(f_syms))
+	for file := range f_syms {
+		f_defs[file] = NewFileDefinitions(f_syms[file])
+	}
+	return ResolveFileDefinitions(f_syms, f_defs)
+}
+
+// ResolveSymbols, with the NewFileDefinitions of each file (e.g., the
+// InputObject.Defs, which are found as the inputs are read).
+func ResolveFileDefinitions(f_syms []elffile.SymbolTable,
+	f_defs []FileDefinitions) []SymLinkInfo {
+	imports_exports := make([]SymLinkInfo, len(f_syms))
+
+	// 1. Get the set of defined and undefined syms, and pick the
+	// definition of each symbol. A strong (STB_GLOBAL) definition
+	// overrides a COMMON symbol, which overrides a weak definition.
+	// Otherwise the first definition is used, so that the result only
+	// depends on the order of the files. (Two strong definitions are
+	// reported by SelectArchiveMembers, and COMMON symbols with the same
+	// name are merged by DoLayout.)
+	globals := NewGlobalSymbols()
+	for file := range f_syms {
+		globals.AddFile(file, f_syms[file], f_defs[file])
+		imports_exports[file] = GetSymLinkInfo(f_syms[file])
+	}
+
+	// 2. Resolve the undefined symbols to the definitions, and note
+	// the definitions which were overridden. Undefined symbols which
+	// aren't defined anywhere are left unresolved (DefSymIndex is 0).
+	for file, ie := range imports_exports {
+		for undef_index := range ie.UndefinedSyms {
+			name := f_syms[file][undef_index].St_name
+			if def, ok := globals.Lookup(name); ok {
+				ie.UndefinedSyms[undef_index] = def
+			}
+		}
+		for def_index := range ie.ExportedSyms {
+			name := f_syms[file][def_index].St_name
+			def, _ := globals.Lookup(name)
+			if def != (Resolver{file, def_index}) {
+				ie.OverriddenSyms[def_index] = def
+			}
+		}
+	}
+	return imports_exports
+}
+
+// Describe the COMMON symbols which were merged with another COMMON
+// symbol, or overridden by a real definition (for --warn-common), in
+// file order. The names are the names of the files, for the messages.
+func CommonSymbolWarnings(f_syms []elffile.SymbolTable, link_info []SymLinkInfo,
+	names []string) []string {
+	warnings := []string{}
+	for file := range f_syms {
+		for k := range f_syms[file] {
+			sym := &f_syms[file][k]
+			if sym.St_shndx != elf.SHN_COMMON {
+				continue
+			}
+			def, ok := link_info[file].OverriddenSyms[k]
+			if !ok {
+				continue
+			}
+			def_sym := &f_syms[def.DefFileIndex][def.DefSymIndex]
+			def_name := names[def.DefFileIndex]
+			switch {
+			case def_sym.St_shndx != elf.SHN_COMMON:
+				warnings = append(warnings, fmt.Sprintf(
+					"%s: common of %s overridden by definition in %s",
+					names[file], sym.St_name, def_name))
+			case def_sym.St_size != sym.St_size:
+				warnings = append(warnings, fmt.Sprintf(
+					"%s: common of %s (size %d) merged with common in %s (size %d)",
+					names[file], sym.St_name, sym.St_size, def_name,
+					def_sym.St_size))
+			default:
+				warnings = append(warnings, fmt.Sprintf(
+					"%s: multiple common of %s (also in %s)",
+					names[file], sym.St_name, def_name))
+			}
+		}
+	}
+	return warnings
+}
+
+// An object file given to the linker, or a member of an archive.
+type InputObject struct {
+	Name string // The file name, or archive(member) for archive members.
+	File elffile.ElfFile
+	Syms elffile.SymbolTable
+	// The global definitions of Syms, found when the object is read.
+	Defs FileDefinitions
+	// For archive members: the index of the member in the archive, and
+	// whether File and Syms have been read yet. Members are only read
+	// when needed.
+	member int
+	loaded bool
+}
+
+// The objects from one input file, in order. An archive has one
+// object for each of its members. All the members of a WholeArchive
+// archive are linked in (--whole-archive), needed or not.
+type InputFile struct {
+	Name         string
+	IsArchive    bool
+	WholeArchive bool
+	Objects      []InputObject
+	Archive      archive.ARFile
+}
+
+// Read the object file, or list the members of the archive
+// (in archive order). Errors are *InputErrors.
+func ReadInputFile(f *os.File, fname string, typ FileType) (InputFile,
+	error) {
+	info, err := f.Stat()
+	if err != nil {
+		return InputFile{}, elffile.FileError(fname, "cannot read file: %s",
+			err)
+	}
+	// The same file may be given more than once (and read concurrently),
+	// so it is read with ReadAt instead of moving the file offset.
+	switch typ {
+	case ELF_FILE:
+		elf_file, err := elffile.ReadElfFileFD(
+			io.NewSectionReader(f, 0, info.Size()))
+		if err != nil {
+			return InputFile{}, elffile.InFile(err, fname)
+		}
+		if elf_file.Header.Type == elf.ET_DYN {
+			// E.g., a libfoo.so found for -lfoo.
+			return InputFile{}, elffile.FileError(fname,
+				"linking with shared libraries is not supported (try -Bstatic)")
+		}
+		syms, err := elf_file.ReadSymbols()
+		if err == nil {
+			err = elf_file.CheckRelocations()
+		}
+		if err != nil {
+			return InputFile{}, elffile.InFile(err, fname)
+		}
+		return InputFile{Name: fname,
+			Objects: []InputObject{{Name: fname, File: elf_file,
+				Syms: syms, Defs: NewFileDefinitions(syms),
+				loaded: true}}}, nil
+	case AR_FILE, THIN_AR_FILE:
+		read_archive := archive.ReadPlainARFile
+		if typ == THIN_AR_FILE {
+			read_archive = archive.ReadThinARFile
+		}
+		ar_file, err := read_archive(f, info.Size(), fname)
+		if err != nil {
+			return InputFile{}, elffile.InFile(err, fname)
+		}
+		result := InputFile{Name: fname, IsArchive: true, Archive: ar_file}
+		for i := range ar_file.Members {
+			name := ar_file.Members[i].Header.Filename
+			result.Objects = append(result.Objects, InputObject{
+				Name: fname + "(" + name + ")", member: i})
+		}
+		return result, nil
+	default:
+		return InputFile{}, elffile.FileError(fname, "unknown file type: %s", typ)
+	}
+}
+
+// Get the i-th object, reading the archive member if necessary.
+func (input *InputFile) object(i int) (*InputObject, error) {
+	obj := &input.Objects[i]
+	if !obj.loaded {
+		member := &input.Archive.Members[obj.member]
+		var err error
+		if obj.File, err = elffile.ReadElfFile(member.Contents); err != nil {
+			return nil, elffile.InMember(err, input.Name, member.Header.Filename)
+		}
+		if obj.Syms, err = obj.File.ReadSymbols(); err != nil {
+			return nil, elffile.InMember(err, input.Name, member.Header.Filename)
+		}
+		if err = obj.File.CheckRelocations(); err != nil {
+			return nil, elffile.InMember(err, input.Name, member.Header.Filename)
+		}
+		obj.Defs = NewFileDefinitions(obj.Syms)
+		obj.loaded = true
+	}
+	return obj, nil
+}
+
+func isGlobalSym(sym *elffile.SymbolTableEntry) bool {
+	return elffile.GetSymBind(sym.St_info) != elf.STB_LOCAL
+}
+
+func IsWeakSym(sym *elffile.SymbolTableEntry) bool {
+	return elffile.GetSymBind(sym.St_info) == elf.STB_WEAK
+}
+
+// How strongly a definition overrides other definitions of the same name:
+// a real definition beats a COMMON symbol, which beats a weak definition.
+func definitionRank(sym *elffile.SymbolTableEntry) int {
+	switch {
+	case IsWeakSym(sym):
+		return 0
+	case sym.St_shndx == elf.SHN_COMMON:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Whether any of the symbols are undefined.
+func anyUndefined(syms []string, undefined map[string]bool) bool {
+	for _, sym := range syms {
+		if undefined[sym] {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the object defines any of the undefined symbols.
+func definesUndefined(obj *InputObject, undefined map[string]bool) bool {
+	for k := 1; k < len(obj.Syms); k++ {
+		sym := &obj.Syms[k]
+		if sym.St_shndx != elf.SHN_UNDEF && isGlobalSym(sym) &&
+			undefined[sym.St_name] {
+			return true
+		}
+	}
+	return false
+}
+
+// A --start-group/--end-group: inputs[Start:End].
+type InputGroup struct {
+	Start, End int
+}
+
+// A rescan of the archives in a group, for the symbols which became
+// undefined during the previous scan.
+type GroupRescan struct {
+	Group   int // Index of the group.
+	Pass    int // 1 for the first rescan.
+	Symbols []string
+}
+
+func (r GroupRescan) String() string {
+	return fmt.Sprintf("rescanning group %d (pass %d) for: %s", r.Group,
+		r.Pass, strings.Join(r.Symbols, ", "))
+}
+
+// A global symbol which is defined by two of the linked objects.
+type DuplicateDefinition struct {
+	Symbol string
+	First  string // Name of the object which defined it first.
+	Second string
+}
+
+func (d DuplicateDefinition) String() string {
+	return fmt.Sprintf("multiple definition of %s: first defined in %s, "+
+		"and again in %s", d.Symbol, d.First, d.Second)
+}
+
+// The result of archive member selection.
+type Selection struct {
+	Objects []InputObject
+	// The rescans of the archive groups, in order.
+	Rescans []GroupRescan
+	// The duplicate definitions, in the order of the objects.
+	Duplicates []DuplicateDefinition
+	// Warnings about archive symbol tables which look out of date.
+	Warnings []string
+}
+
+// Whether the symbol is a definition which must be unique. Weak and
+// common symbols may have several definitions, and so may the symbols
+// of COMDAT groups (only one copy of the group is kept).
+func isUniqueDefinition(sym *elffile.SymbolTableEntry, comdat map[int]bool) bool {
+	if elffile.GetSymBind(sym.St_info) != elf.STB_GLOBAL ||
+		sym.St_shndx == elf.SHN_UNDEF || sym.St_shndx == elf.SHN_COMMON {
+		return false
+	}
+	shndx, ok := sym.Section()
+	return !ok || !comdat[shndx]
+}
+
+// The state of archive member selection.
+type memberSelector struct {
+	inputs     []InputFile
+	result     []InputObject
+	duplicates []DuplicateDefinition
+	warnings   []string
+	defined    map[string]bool
+	undefined  map[string]bool
+	// Name of the object with the unique definition of each symbol.
+	definer map[string]string
+	// Symbols which became undefined since this was last reset.
+	newly_undefined map[string]bool
+	// For each archive, which members have been pulled in.
+	included [][]bool
+}
+
+func (s *memberSelector) addObject(obj *InputObject) {
+	s.result = append(s.result, *obj)
+	comdat := make(map[int]bool)
+	for _, group := range elffile.ComdatGroups(&obj.File, obj.Syms) {
+		for _, member := range group.Members {
+			comdat[member] = true
+		}
+	}
+	for k := 1; k < len(obj.Syms); k++ {
+		sym := &obj.Syms[k]
+		if !isGlobalSym(sym) {
+			continue
+		}
+		if isUniqueDefinition(sym, comdat) {
+			if first, ok := s.definer[sym.St_name]; ok {
+				s.duplicates = append(s.duplicates, DuplicateDefinition{
+					sym.St_name, first, obj.Name})
+			} else {
+				s.definer[sym.St_name] = obj.Name
+			}
+		}
+		if sym.St_shndx != elf.SHN_UNDEF {
+			s.defined[sym.St_name] = true
+			delete(s.undefined, sym.St_name)
+		} else if !IsWeakSym(sym) && !s.defined[sym.St_name] &&
+			!s.undefined[sym.St_name] {
+			// Weak references don't pull in archive members.
+			s.undefined[sym.St_name] = true
+			s.newly_undefined[sym.St_name] = true
+		}
+	}
+}
+
+// Add an object file, or scan an archive until no more of its members
+// are pulled in.
+func (s *memberSelector) scanInput(n int) error {
+	input := &s.inputs[n]
+	if !input.IsArchive {
+		for i := range input.Objects {
+			s.addObject(&input.Objects[i])
+		}
+		return nil
+	}
+	has_index := len(input.Archive.Symbols) != 0
+	// The symbols which each member defines, according to the index.
+	indexed := make([][]string, len(input.Objects))
+	for _, entry := range input.Archive.Symbols {
+		indexed[entry.Member] = append(indexed[entry.Member], entry.Name)
+	}
+	included := s.included[n]
+	if input.WholeArchive {
+		for i := range input.Objects {
+			if !included[i] {
+				obj, err := input.object(i)
+				if err != nil {
+					return err
+				}
+				s.addObject(obj)
+				included[i] = true
+			}
+		}
+		return nil
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := range input.Objects {
+			if included[i] {
+				continue
+			}
+			if has_index && !anyUndefined(indexed[i], s.undefined) {
+				continue
+			}
+			obj, err := input.object(i)
+			if err != nil {
+				return err
+			}
+			if !has_index {
+				if !definesUndefined(obj, s.undefined) {
+					continue
+				}
+			} else {
+				for _, problem := range input.Archive.CheckSymbolIndex(
+					i, obj.Syms) {
+					s.warnings = append(s.warnings,
+						fmt.Sprintf("%s: %s", input.Name, problem))
+				}
+			}
+			s.addObject(obj)
+			included[i] = true
+			changed = true
+		}
+	}
+	return nil
+}
+
+// Scan the inputs of a group, then rescan its archives as long as the
+// previous scan left new undefined symbols.
+func (s *memberSelector) scanGroup(index int, group InputGroup) (
+	[]GroupRescan, error) {
+	rescans := []GroupRescan{}
+	for pass := 0; ; pass++ {
+		s.newly_undefined = make(map[string]bool)
+		for n := group.Start; n < group.End; n++ {
+			if pass == 0 || s.inputs[n].IsArchive {
+				if err := s.scanInput(n); err != nil {
+					return nil, err
+				}
+			}
+		}
+		symbols := []string{}
+		for name := range s.newly_undefined {
+			if s.undefined[name] {
+				symbols = append(symbols, name)
+			}
+		}
+		if len(symbols) == 0 {
+			return rescans, nil
+		}
+		sort.Strings(symbols)
+		rescans = append(rescans, GroupRescan{index, pass + 1, symbols})
+	}
+}
+
+// Decide which objects are part of the link. Every object file is, but
+// an archive member is only pulled in if it defines a symbol which is
+// still undefined when the archive is reached. Each archive is scanned
+// again until no more of its members are pulled in. As with a traditional
+// Unix linker, an archive is not revisited for the undefined symbols of
+// objects which come after it, unless they are in the same group.
+// The archives of a group are scanned again and again, until they leave
+// no new undefined symbols; each of these rescans is returned too.
+// Members are considered in archive order, so if several members define
+// a symbol, the first one is pulled in. All the members of a WholeArchive
+// archive are pulled in, and if two objects both define a symbol, that
+// is reported as a duplicate definition.
+// If the archive has a symbol table, only the members it lists for the
+// undefined symbols are read. Those members are checked against the
+// symbol table, and the selection has a warning for each difference
+// (the symbol table looks out of date).
+// Archive members which can't be read are an error.
+func SelectArchiveMembers(inputs []InputFile,
+	groups []InputGroup) (Selection, error) {
+	s := memberSelector{inputs: inputs, result: []InputObject{},
+		duplicates:      []DuplicateDefinition{},
+		warnings:        []string{},
+		defined:         make(map[string]bool),
+		definer:         make(map[string]string),
+		undefined:       make(map[string]bool),
+		newly_undefined: make(map[string]bool),
+		included:        make([][]bool, len(inputs))}
+	for n := range inputs {
+		s.included[n] = make([]bool, len(inputs[n].Objects))
+	}
+	rescans := []GroupRescan{}
+	next_group := 0
+	for n := 0; n < len(inputs); n++ {
+		if next_group < len(groups) && groups[next_group].Start == n {
+			group := groups[next_group]
+			group_rescans, err := s.scanGroup(next_group, group)
+			if err != nil {
+				return Selection{}, err
+			}
+			rescans = append(rescans, group_rescans...)
+			next_group++
+			n = group.End - 1
+			continue
+		}
+		if err := s.scanInput(n); err != nil {
+			return Selection{}, err
+		}
+	}
+	return Selection{s.result, rescans, s.duplicates, s.warnings}, nil
+}
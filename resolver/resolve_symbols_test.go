@@ -0,0 +1,398 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test symbol resolution and archive member selection.
+
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jvoung/go-ld/archive"
+	"github.com/jvoung/go-ld/elffile"
+	. "github.com/jvoung/go-ld/internal/testutil"
+	. "github.com/jvoung/go-ld/internal/testutil/elftest"
+)
+
+func readInputFileForTest(t *testing.T, fname string) InputFile {
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatal("Failed to open", fname, err)
+	}
+	defer f.Close()
+	types, err := ValidateFiles(map[string]*os.File{fname: f})
+	AssertNoError(t, err)
+	input, err := ReadInputFile(f, fname, types[fname])
+	AssertNoError(t, err)
+	return input
+}
+
+func selectArchiveMembersForTest(t *testing.T, inputs []InputFile,
+	groups []InputGroup) Selection {
+	selection, err := SelectArchiveMembers(inputs, groups)
+	AssertNoError(t, err)
+	return selection
+}
+
+func selectForTest(t *testing.T, inputs []InputFile) []InputObject {
+	return selectArchiveMembersForTest(t, inputs, nil).Objects
+}
+
+func objectNames(objects []InputObject) []string {
+	names := make([]string, len(objects))
+	for i := range objects {
+		names[i] = objects[i].Name
+	}
+	return names
+}
+
+func TestSelectArchiveMembers(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	crt := path.Join(TestX8632BaseDir(), "libcrt_platform.a")
+	libgcc := path.Join(TestX8632BaseDir(), "libgcc.a")
+	inputs := []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, crt), readInputFileForTest(t, libgcc)}
+	ExpectEq(t, false, inputs[0].IsArchive)
+	ExpectEq(t, true, inputs[1].IsArchive)
+	ExpectEq(t, 3, len(inputs[1].Objects))
+
+	// __udivdi3 needs __udivmoddi4 from the same archive,
+	// which takes a second look at the archive.
+	names := objectNames(selectForTest(t, inputs))
+	expected := []string{obj, crt + "(string.o)", libgcc + "(udivdi3.o)",
+		libgcc + "(udivmoddi4.o)"}
+	AssertEq(t, len(expected), len(names))
+	for i := range expected {
+		ExpectEq(t, expected[i], names[i])
+	}
+}
+
+// The definitions found as the objects are read (object files) or
+// pulled in (archive members) resolve the symbols like ResolveSymbols.
+func TestResolveFileDefinitions(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	libgcc := path.Join(TestX8632BaseDir(), "libgcc.a")
+	objects := selectForTest(t, []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, libgcc)})
+	AssertEq(t, 3, len(objects))
+	f_syms := make([]elffile.SymbolTable, len(objects))
+	f_defs := make([]FileDefinitions, len(objects))
+	for i := range objects {
+		f_syms[i] = objects[i].Syms
+		f_defs[i] = objects[i].Defs
+		ExpectEqM(t, false, len(f_defs[i].defs) == 0, objects[i].Name)
+	}
+	link_info := ResolveFileDefinitions(f_syms, f_defs)
+	expected := ResolveSymbols(f_syms)
+	for i := range expected {
+		AssertEq(t, len(expected[i].UndefinedSyms),
+			len(link_info[i].UndefinedSyms))
+		for k, def := range expected[i].UndefinedSyms {
+			ExpectEqM(t, def, link_info[i].UndefinedSyms[k], f_syms[i][k].St_name)
+		}
+	}
+	// __udivdi3 is resolved to libgcc.a(udivdi3.o).
+	found := false
+	for k, def := range link_info[0].UndefinedSyms {
+		if f_syms[0][k].St_name == "__udivdi3" {
+			found = true
+			ExpectEq(t, Resolver{1, def.DefSymIndex}, def)
+			ExpectEq(t, "__udivdi3", f_syms[1][def.DefSymIndex].St_name)
+		}
+	}
+	ExpectEq(t, true, found)
+}
+
+func TestSelectArchiveMembersOrder(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	crt := path.Join(TestX8632BaseDir(), "libcrt_platform.a")
+	// An archive is only searched for the symbols which are undefined
+	// by the time it is reached.
+	inputs := []InputFile{readInputFileForTest(t, crt),
+		readInputFileForTest(t, obj)}
+	names := objectNames(selectForTest(t, inputs))
+	AssertEq(t, 1, len(names))
+	ExpectEq(t, obj, names[0])
+
+	// Once a symbol is defined, a later archive does not pull in
+	// another definition of it.
+	crtbegin := path.Join(TestX8632BaseDir(), "crtbegin.o")
+	inputs = []InputFile{readInputFileForTest(t, crtbegin),
+		readInputFileForTest(t, crt), readInputFileForTest(t, crt)}
+	names = objectNames(selectForTest(t, inputs))
+	AssertEq(t, 2, len(names))
+	ExpectEq(t, crt+"(pnacl_irt.o)", names[1])
+}
+
+// With the archive symbol table, the unneeded members aren't even read.
+func TestSelectArchiveMembersLazy(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	crt := path.Join(TestX8632BaseDir(), "libcrt_platform.a")
+	inputs := []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, crt)}
+	selectForTest(t, inputs)
+	for _, member := range inputs[1].Objects {
+		ExpectEqM(t, member.Name == crt+"(string.o)", member.loaded, member.Name)
+	}
+}
+
+// The members pulled in are checked against the archive symbol table,
+// with a warning for each difference.
+func TestSelectArchiveMembersStaleIndex(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	crt := path.Join(TestX8632BaseDir(), "libcrt_platform.a")
+	inputs := []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, crt)}
+	ExpectEq(t, 0, len(selectArchiveMembersForTest(t, inputs, nil).Warnings))
+
+	inputs[1] = readInputFileForTest(t, crt)
+	// Pretend that the index is from an older string.o with bzero.
+	members := inputs[1].Archive.MembersNamed("string.o")
+	AssertEq(t, 1, len(members))
+	inputs[1].Archive.Symbols = append(inputs[1].Archive.Symbols,
+		archive.ARSymbol{Name: "bzero", Member: members[0]})
+	selection := selectArchiveMembersForTest(t, inputs, nil)
+	AssertEq(t, 2, len(selection.Objects))
+	AssertEq(t, 1, len(selection.Warnings))
+	ExpectEq(t, crt+": archive index says string.o defines bzero, but it "+
+		"does not", selection.Warnings[0])
+}
+
+// A thin archive is searched just like a regular one.
+func TestSelectArchiveMembersThin(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	thin := path.Join(TestX8632BaseDir(), "libthin_nested.a")
+	inputs := []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, thin)}
+	ExpectEq(t, true, inputs[1].IsArchive)
+	names := objectNames(selectForTest(t, inputs))
+	expected := []string{obj, thin + "(libcrt_platform.a(string.o))",
+		thin + "(libgcc.a(udivdi3.o))", thin + "(libgcc.a(udivmoddi4.o))"}
+	AssertEq(t, len(expected), len(names))
+	for i := range expected {
+		ExpectEq(t, expected[i], names[i])
+	}
+}
+
+// Of two members with the same name which both define a symbol, the
+// first one in the archive is pulled in, with or without the index.
+func TestSelectArchiveMembersDuplicates(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive_dup.o")
+	lib := path.Join(TestX8632BaseDir(), "libdup.a")
+	for _, use_index := range []bool{true, false} {
+		inputs := []InputFile{readInputFileForTest(t, obj),
+			readInputFileForTest(t, lib)}
+		if !use_index {
+			inputs[1].Archive.Symbols = nil
+		}
+		objects := selectForTest(t, inputs)
+		AssertEq(t, 2, len(objects))
+		ExpectEq(t, lib+"(util.o)", objects[1].Name)
+		ExpectEq(t, 0, objects[1].member)
+	}
+}
+
+// The archives of a group are rescanned, for the symbols which are
+// undefined by members from later archives in the group.
+func TestSelectArchiveMembersGroup(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive_group.o")
+	lib_a := path.Join(TestX8632BaseDir(), "libgroup_a.a")
+	lib_b := path.Join(TestX8632BaseDir(), "libgroup_b.a")
+	read_inputs := func() []InputFile {
+		return []InputFile{readInputFileForTest(t, obj),
+			readInputFileForTest(t, lib_a), readInputFileForTest(t, lib_b)}
+	}
+
+	// Without the group, libgroup_a.a isn't searched again for group_a2.
+	names := objectNames(selectForTest(t, read_inputs()))
+	AssertEq(t, 3, len(names))
+	ExpectEq(t, lib_b+"(b1.o)", names[2])
+
+	selection := selectArchiveMembersForTest(t, read_inputs(), []InputGroup{{1, 3}})
+	names = objectNames(selection.Objects)
+	expected := []string{obj, lib_a + "(a1.o)", lib_b + "(b1.o)",
+		lib_a + "(a2.o)"}
+	AssertEq(t, len(expected), len(names))
+	for i := range expected {
+		ExpectEq(t, expected[i], names[i])
+	}
+	AssertEq(t, 1, len(selection.Rescans))
+	ExpectEq(t, "rescanning group 0 (pass 1) for: group_a2",
+		selection.Rescans[0].String())
+
+	// An object in the group is only added once, and an empty group
+	// is fine.
+	selection = selectArchiveMembersForTest(t, read_inputs(),
+		[]InputGroup{{0, 0}, {0, 3}})
+	ExpectEq(t, len(expected), len(selection.Objects))
+	ExpectEq(t, 1, len(selection.Rescans))
+}
+
+// With --whole-archive, every member is pulled in.
+func TestSelectArchiveMembersWhole(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive.o")
+	crt := path.Join(TestX8632BaseDir(), "libcrt_platform.a")
+	inputs := []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, crt)}
+	inputs[1].WholeArchive = true
+	selection := selectArchiveMembersForTest(t, inputs, nil)
+	names := objectNames(selection.Objects)
+	expected := []string{obj, crt + "(pnacl_irt.o)", crt + "(setjmp.o)",
+		crt + "(string.o)"}
+	AssertEq(t, len(expected), len(names))
+	for i := range expected {
+		ExpectEq(t, expected[i], names[i])
+	}
+	ExpectEq(t, 0, len(selection.Duplicates))
+}
+
+// Both util.o members define util_value, which is only an error if
+// both are linked in. The first definition is always reported as the
+// first one.
+func TestSelectArchiveMembersWholeDuplicates(t *testing.T) {
+	obj := path.Join(TestX8632BaseDir(), "test_archive_dup.o")
+	lib := path.Join(TestX8632BaseDir(), "libdup.a")
+	inputs := []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, lib)}
+	ExpectEq(t, 0, len(selectArchiveMembersForTest(t, inputs, nil).Duplicates))
+
+	inputs = []InputFile{readInputFileForTest(t, obj),
+		readInputFileForTest(t, lib)}
+	inputs[1].WholeArchive = true
+	selection := selectArchiveMembersForTest(t, inputs, nil)
+	ExpectEq(t, 3, len(selection.Objects))
+	AssertEq(t, 1, len(selection.Duplicates))
+	ExpectEq(t, DuplicateDefinition{"util_value", lib + "(util.o)",
+		lib + "(util.o)"}, selection.Duplicates[0])
+	ExpectEq(t, "multiple definition of util_value: first defined in "+
+		lib+"(util.o), and again in "+lib+"(util.o)",
+		selection.Duplicates[0].String())
+}
+
+// Like the crtall.o of make_unified.sh: all the runtime archives, whole.
+// Their members don't define anything twice.
+func TestSelectArchiveMembersWholeRuntime(t *testing.T) {
+	inputs := []InputFile{}
+	members := 0
+	for _, name := range []string{"crtbegin.o", "libcrt_platform.a",
+		"libgcc.a", "libpnacl_irt_shim.a", "crtend.o"} {
+		input := readInputFileForTest(t, path.Join(TestX8632BaseDir(), name))
+		input.WholeArchive = true
+		members += len(input.Objects)
+		inputs = append(inputs, input)
+	}
+	selection := selectArchiveMembersForTest(t, inputs, nil)
+	ExpectEq(t, members, len(selection.Objects))
+	for _, duplicate := range selection.Duplicates {
+		t.Error("Unexpected", duplicate.String())
+	}
+}
+
+// Weak references don't pull in archive members, and weak definitions
+// don't conflict with strong ones.
+func TestSelectArchiveMembersWeak(t *testing.T) {
+	main_obj := path.Join(TestX8632BaseDir(), "test_weak_main.o")
+	strong := path.Join(TestX8632BaseDir(), "test_weak_strong.o")
+	lib := path.Join(TestX8632BaseDir(), "libweak.a")
+	inputs := []InputFile{readInputFileForTest(t, main_obj),
+		readInputFileForTest(t, strong), readInputFileForTest(t, lib)}
+	selection := selectArchiveMembersForTest(t, inputs, nil)
+	names := objectNames(selection.Objects)
+	AssertEq(t, 2, len(names))
+	ExpectEq(t, strong, names[1])
+	ExpectEq(t, 0, len(selection.Duplicates))
+
+	// Two strong definitions are an error.
+	inputs = []InputFile{readInputFileForTest(t, strong),
+		readInputFileForTest(t, main_obj), readInputFileForTest(t, strong)}
+	selection = selectArchiveMembersForTest(t, inputs, nil)
+	AssertEq(t, 1, len(selection.Duplicates))
+	ExpectEq(t, DuplicateDefinition{"overridden", strong, strong},
+		selection.Duplicates[0])
+}
+
+func TestCommonSymbolWarnings(t *testing.T) {
+	a := ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_common_a.o"))
+	b := ReadElfFileFname(path.Join(TestX8632BaseDir(), "test_common_b.o"))
+	f_syms := []elffile.SymbolTable{ReadSymbolsForTest(a), ReadSymbolsForTest(b),
+		ReadSymbolsForTest(a)}
+	names := []string{"a.o", "b.o", "again.o"}
+	warnings := CommonSymbolWarnings(f_syms, ResolveSymbols(f_syms), names)
+	expected := []string{
+		"a.o: common of common_overridden overridden by definition in b.o",
+		"b.o: common of common_merged (size 64) merged with common in a.o " +
+			"(size 4)",
+		"again.o: multiple common of common_merged (also in a.o)",
+		"again.o: multiple common of common_a (also in a.o)",
+		"again.o: common of common_overridden overridden by definition in b.o"}
+	AssertEq(t, len(expected), len(warnings))
+	for i := range expected {
+		ExpectEq(t, expected[i], warnings[i])
+	}
+}
+
+// An archive with one member, with the given size field.
+func arFileForTest(t *testing.T, dir string, name string, size string,
+	body string) string {
+	fname := path.Join(dir, name)
+	WriteFileForTest(t, fname, archive.AR_MAGIC+fmt.Sprintf("%-16s%-12s%-6s%-6s%-8s"+
+		"%-10s`\n", "bad.o/", "0", "0", "0", "644", size)+body)
+	return fname
+}
+
+func TestReadInputFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	bad_size := arFileForTest(t, dir, "bad_size.a", "12x", "")
+	_, err := readInputFileWithError(t, bad_size)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, bad_size+":0x8: bad member size \"12x\"", err.Error())
+	for _, size := range []string{"-5", "9999999999"} {
+		too_big := arFileForTest(t, dir, "too_big.a", size, "")
+		_, err = readInputFileWithError(t, too_big)
+		AssertEq(t, false, err == nil)
+		ExpectEq(t, too_big+":0x8: member size "+size+" runs past the end "+
+			"of the archive (68 bytes)", err.Error())
+	}
+
+	// The members are only read when they are needed.
+	bad_member := arFileForTest(t, dir, "bad_member.a", "20",
+		"\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x03\x00")
+	input, err := readInputFileWithError(t, bad_member)
+	AssertNoError(t, err)
+	input.WholeArchive = true
+	_, err = SelectArchiveMembers([]InputFile{input}, nil)
+	AssertEq(t, false, err == nil)
+	var input_err *elffile.InputError
+	AssertEq(t, true, errors.As(err, &input_err))
+	ExpectEq(t, bad_member, input_err.File)
+	ExpectEq(t, "bad.o", input_err.Member)
+	ExpectEq(t, int64(0x10), input_err.Offset)
+	ExpectEq(t, bad_member+"(bad.o):0x10: failed to read ELF machine",
+		err.Error())
+
+	_, err = readInputFileWithError(t, path.Join(dir, "missing.a"))
+	AssertEq(t, false, err == nil)
+	not_elf := path.Join(dir, "not_elf.o")
+	WriteFileForTest(t, not_elf, "not an ELF file\n")
+	_, err = readInputFileWithError(t, not_elf)
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, not_elf+": not an ELF file or archive", err.Error())
+}
+
+func readInputFileWithError(t *testing.T, fname string) (InputFile, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return InputFile{}, err
+	}
+	defer f.Close()
+	types, err := ValidateFiles(map[string]*os.File{fname: f})
+	if err != nil {
+		return InputFile{}, err
+	}
+	return ReadInputFile(f, fname, types[fname])
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Response files: an "@path" argument is replaced by the arguments in the
+// file, which are separated by whitespace. As in GNU tools, single or
+// double quotes group characters (including whitespace) into one
+// argument, and a backslash escapes the next character. Response files
+// may contain "@path" arguments too, which are relative to the current
+// directory (not the response file). Like GNU ld, an "@path" which can't
+// be read (e.g., it doesn't exist) is kept as an argument.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// A command-line argument, and where it came from: a response file
+// and line, or the command line itself (File is empty).
+type CommandArg struct {
+	Value string
+	File  string
+	Line  int
+}
+
+// Make an error about the argument, which points to the response file
+// and line of the argument, if it came from a response file.
+func (a CommandArg) Errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if a.File == "" {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s:%d: %s", a.File, a.Line, msg)
+}
+
+func isResponseFileSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' ||
+		c == '\v'
+}
+
+// Split the contents of a response file into arguments.
+func splitResponseFile(fname string, contents string) ([]CommandArg, error) {
+	args := []CommandArg{}
+	line := 1
+	for i := 0; i < len(contents); {
+		if isResponseFileSpace(contents[i]) {
+			if contents[i] == '\n' {
+				line++
+			}
+			i++
+			continue
+		}
+		arg := CommandArg{File: fname, Line: line}
+		var value []byte
+		var quote byte
+		for ; i < len(contents); i++ {
+			c := contents[i]
+			if quote == 0 && isResponseFileSpace(c) {
+				break
+			}
+			if c == '\n' {
+				line++
+			}
+			switch {
+			case c == '\\' && i+1 < len(contents):
+				i++
+				if contents[i] == '\n' {
+					line++
+				}
+				value = append(value, contents[i])
+			case quote != 0 && c == quote:
+				quote = 0
+			case quote == 0 && (c == '\'' || c == '"'):
+				quote = c
+			default:
+				value = append(value, c)
+			}
+		}
+		if quote != 0 {
+			return nil, arg.Errorf("unterminated %c quote", quote)
+		}
+		arg.Value = string(value)
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// Replace the response file arguments with their contents, recursively.
+// The stack has the response files being expanded, to catch cycles.
+func expandResponseFiles(args []CommandArg, stack []string) ([]CommandArg,
+	error) {
+	result := make([]CommandArg, 0, len(args))
+	for _, arg := range args {
+		if len(arg.Value) < 2 || arg.Value[0] != '@' {
+			result = append(result, arg)
+			continue
+		}
+		fname := arg.Value[1:]
+		abs_name, err := filepath.Abs(fname)
+		if err != nil {
+			return nil, arg.Errorf("bad response file %s: %s", fname, err)
+		}
+		for i, open := range stack {
+			if open == abs_name {
+				return nil, arg.Errorf("response file %s includes itself: %s",
+					fname, strings.Join(stack[i:], " -> ")+" -> "+abs_name)
+			}
+		}
+		contents, err := ioutil.ReadFile(fname)
+		if err != nil {
+			// Not a response file, so it's probably an input file.
+			result = append(result, arg)
+			continue
+		}
+		file_args, err := splitResponseFile(fname, string(contents))
+		if err != nil {
+			return nil, err
+		}
+		expanded, err := expandResponseFiles(file_args,
+			append(stack, abs_name))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
+
+// Expand the response files in the command-line arguments.
+func ExpandResponseFiles(args []string) ([]CommandArg, error) {
+	command_args := make([]CommandArg, len(args))
+	for i, arg := range args {
+		command_args[i] = CommandArg{Value: arg}
+	}
+	return expandResponseFiles(command_args, nil)
+}
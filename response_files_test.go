@@ -0,0 +1,115 @@
+// Copyright (c) 2014, Jan Voung
+// All rights reserved.
+
+// Test response file expansion.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jvoung/go-ld/driver"
+	. "github.com/jvoung/go-ld/internal/testutil"
+)
+
+func tempDirForTest(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "go-ld-response-files")
+	if err != nil {
+		t.Fatal("Failed to create temp dir", err)
+	}
+	return dir
+}
+
+func TestSplitResponseFile(t *testing.T) {
+	args, err := splitResponseFile("f.rsp",
+		"a.o  -o out\n\t'file with space.o' \"-L/my dir\"\n"+
+			"back\\ slash\\\\ -e'nt'\"ry\" \"a\nb\" last\n\n")
+	AssertEq(t, nil, err)
+	expected := []CommandArg{
+		{"a.o", "f.rsp", 1},
+		{"-o", "f.rsp", 1},
+		{"out", "f.rsp", 1},
+		{"file with space.o", "f.rsp", 2},
+		{"-L/my dir", "f.rsp", 2},
+		{"back slash\\", "f.rsp", 3},
+		{"-entry", "f.rsp", 3},
+		{"a\nb", "f.rsp", 3},
+		{"last", "f.rsp", 4}}
+	AssertEq(t, len(expected), len(args))
+	for i := range expected {
+		ExpectEq(t, expected[i], args[i])
+	}
+
+	_, err = splitResponseFile("f.rsp", "a.o\n-o 'out\n")
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, "f.rsp:2: unterminated ' quote", err.Error())
+}
+
+func TestExpandResponseFiles(t *testing.T) {
+	dir := tempDirForTest(t)
+	defer os.RemoveAll(dir)
+	outer := path.Join(dir, "outer.rsp")
+	inner := path.Join(dir, "inner.rsp")
+	WriteFileForTest(t, outer, "-o out\n@"+inner+"\nlast.o\n")
+	WriteFileForTest(t, inner, "-lfoo middle.o\n")
+
+	c := parseForTest(t, "first.o", "@"+outer, "-e", "main")
+	ExpectEq(t, "out", c.Outfile)
+	ExpectEq(t, "main", c.EntryPointFunc)
+	checkInputs(t, []driver.InputArg{
+		{Kind: driver.InputFileName, Value: "first.o"},
+		{Kind: driver.InputLibrary, Value: "foo"},
+		{Kind: driver.InputFileName, Value: "middle.o"},
+		{Kind: driver.InputFileName, Value: "last.o"}}, c)
+}
+
+// As in GNU ld, an "@path" which can't be read is an argument itself,
+// so it is an input file (or an error, if it doesn't exist either).
+func TestResponseFileMissing(t *testing.T) {
+	dir := tempDirForTest(t)
+	defer os.RemoveAll(dir)
+	missing := path.Join(dir, "missing.rsp")
+	outer := path.Join(dir, "outer.rsp")
+	WriteFileForTest(t, outer, "a.o @"+missing+"\n")
+	c := parseForTest(t, "@"+missing, "@"+dir, "@"+outer)
+	checkInputs(t, []driver.InputArg{
+		{Kind: driver.InputFileName, Value: "@" + missing},
+		{Kind: driver.InputFileName, Value: "@" + dir},
+		{Kind: driver.InputFileName, Value: "a.o"},
+		{Kind: driver.InputFileName, Value: "@" + missing}}, c)
+}
+
+// Errors point to the response file and line of the bad option.
+func TestResponseFileErrors(t *testing.T) {
+	dir := tempDirForTest(t)
+	defer os.RemoveAll(dir)
+	bad := path.Join(dir, "bad.rsp")
+	WriteFileForTest(t, bad, "a.o\n\nb.o --bogus\n")
+	_, err := ParseCommandLine([]string{"@" + bad})
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, bad+":3: unrecognized option --bogus", err.Error())
+
+	// A response file which includes itself, directly or not.
+	self := path.Join(dir, "self.rsp")
+	WriteFileForTest(t, self, "a.o\n@"+self+"\n")
+	_, err = ParseCommandLine([]string{"@" + self})
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, self+":2: response file "+self+" includes itself: "+
+		self+" -> "+self, err.Error())
+	a := path.Join(dir, "a.rsp")
+	b := path.Join(dir, "b.rsp")
+	WriteFileForTest(t, a, "@"+b+"\n")
+	WriteFileForTest(t, b, "b.o @"+a+"\n")
+	_, err = ParseCommandLine([]string{"@" + a})
+	AssertEq(t, false, err == nil)
+	ExpectEq(t, b+":1: response file "+a+" includes itself: "+
+		a+" -> "+b+" -> "+a, err.Error())
+
+	// The same file may be used twice, if it doesn't include itself.
+	WriteFileForTest(t, b, "b.o\n")
+	c := parseForTest(t, "@"+b, "@"+b)
+	ExpectEq(t, 2, len(c.Inputs))
+}
@@ -0,0 +1,29 @@
+#!/bin/bash
+
+# Set up the archive format variant test binaries with llvm-ar:
+# BSD archives (with "#1/len" long filenames and a __.SYMDEF symbol table),
+# and a GNU archive with a 64-bit /SYM64/ symbol table (which is normally
+# only used for archives over 4GB, but llvm-ar can be told to use it).
+
+set -e
+set -u
+set -x
+
+readonly AR=llvm-ar
+readonly TMP=$(mktemp -d)
+trap "rm -rf ${TMP}" EXIT
+
+readonly CRT_MEMBERS="pnacl_irt.o setjmp.o string.o"
+readonly I686=$(pwd)/test_binaries/i686
+(cd ${TMP} && ar x ${I686}/libcrt_platform.a ${CRT_MEMBERS})
+rm -f ${I686}/libcrt_platform_bsd.a ${I686}/libcrt_platform_sym64.a
+(cd ${TMP} && ${AR} rcs --format=bsd ${I686}/libcrt_platform_bsd.a \
+    ${CRT_MEMBERS})
+(cd ${TMP} && SYM64_THRESHOLD=0 ${AR} rcs --format=gnu \
+    ${I686}/libcrt_platform_sym64.a ${CRT_MEMBERS})
+
+readonly LIBDIR=test_binaries/test_libdir
+rm -f ${LIBDIR}/liblong_filename_bsd.a
+(cd ${LIBDIR} && ${AR} rcS --format=bsd liblong_filename_bsd.a \
+    file_11.txt file_24.txt file_nil.txt file_quick_brown_fox_jumped.txt \
+    "file with space in it.txt")
@@ -0,0 +1,12 @@
+/* Needs members from libgcc.a (__udivdi3, which in turn needs
+   __udivmoddi4) and from libcrt_platform.a (memcpy), but nothing else. */
+
+void *memcpy(void *dst, const void *src, __SIZE_TYPE__ n);
+
+unsigned long long Divide(unsigned long long a, unsigned long long b) {
+  return a / b;
+}
+
+void Copy(char *dst, const char *src) {
+  memcpy(dst, src, 16);
+}
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# Set up the archive member selection test binary from test_archive.c.
+# Only x86-32 needs a libgcc.a helper for 64-bit division, so that is
+# the only one built (with the host gcc).
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_archive.c
+readonly CFLAGS="-O1 -fno-pic -fno-builtin -fno-asynchronous-unwind-tables -fno-stack-protector"
+
+gcc -m32 ${CFLAGS} -c ${SRC} -o test_binaries/i686/test_archive.o
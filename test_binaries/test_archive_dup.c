@@ -0,0 +1,23 @@
+/* Built three ways for the duplicate archive member test: the main
+   object, which needs util_value, and two different util.o members,
+   which both define it. The first member in the archive should win. */
+
+#if defined(DUP_MAIN)
+int util_value(void);
+
+int UseUtil(void) {
+  return util_value();
+}
+#elif defined(DUP_FIRST)
+int util_value(void) {
+  return 1;
+}
+#elif defined(DUP_SECOND)
+int util_value(void) {
+  return 2;
+}
+
+int util_second_only(void) {
+  return 3;
+}
+#endif
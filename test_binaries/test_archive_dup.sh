@@ -0,0 +1,23 @@
+#!/bin/bash
+
+# Set up the duplicate archive member test binaries from test_archive_dup.c:
+# test_archive_dup.o, and libdup.a, which has two members named util.o
+# (as if from different directories). "ar q" appends instead of
+# replacing the first util.o.
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_archive_dup.c
+readonly OUT=test_binaries/i686
+readonly CFLAGS="-m32 -O1 -fno-pic -fno-asynchronous-unwind-tables -fno-stack-protector"
+readonly TMP=$(mktemp -d)
+trap "rm -rf ${TMP}" EXIT
+
+mkdir ${TMP}/first ${TMP}/second
+gcc ${CFLAGS} -DDUP_MAIN -c ${SRC} -o ${OUT}/test_archive_dup.o
+gcc ${CFLAGS} -DDUP_FIRST -c ${SRC} -o ${TMP}/first/util.o
+gcc ${CFLAGS} -DDUP_SECOND -c ${SRC} -o ${TMP}/second/util.o
+rm -f ${OUT}/libdup.a
+ar qcs ${OUT}/libdup.a ${TMP}/first/util.o ${TMP}/second/util.o
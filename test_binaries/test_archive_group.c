@@ -0,0 +1,28 @@
+/* Built several ways for the archive group test: the main object, which
+   needs group_a, and members of two archives which need each other:
+   libgroup_a.a(a1.o) needs group_b from libgroup_b.a(b1.o), which
+   needs group_a2 back from libgroup_a.a(a2.o). */
+
+#if defined(GROUP_MAIN)
+int group_a(void);
+
+int UseGroup(void) {
+  return group_a();
+}
+#elif defined(GROUP_A1)
+int group_b(void);
+
+int group_a(void) {
+  return group_b() + 1;
+}
+#elif defined(GROUP_A2)
+int group_a2(void) {
+  return 2;
+}
+#elif defined(GROUP_B1)
+int group_a2(void);
+
+int group_b(void) {
+  return group_a2() + 3;
+}
+#endif
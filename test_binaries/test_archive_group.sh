@@ -0,0 +1,23 @@
+#!/bin/bash
+
+# Set up the archive group test binaries from test_archive_group.c:
+# test_archive_group.o, and libgroup_a.a and libgroup_b.a, which
+# depend on each other.
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_archive_group.c
+readonly OUT=test_binaries/i686
+readonly CFLAGS="-m32 -O1 -fno-pic -fno-asynchronous-unwind-tables -fno-stack-protector"
+readonly TMP=$(mktemp -d)
+trap "rm -rf ${TMP}" EXIT
+
+gcc ${CFLAGS} -DGROUP_MAIN -c ${SRC} -o ${OUT}/test_archive_group.o
+gcc ${CFLAGS} -DGROUP_A1 -c ${SRC} -o ${TMP}/a1.o
+gcc ${CFLAGS} -DGROUP_A2 -c ${SRC} -o ${TMP}/a2.o
+gcc ${CFLAGS} -DGROUP_B1 -c ${SRC} -o ${TMP}/b1.o
+rm -f ${OUT}/libgroup_a.a ${OUT}/libgroup_b.a
+ar rcs ${OUT}/libgroup_a.a ${TMP}/a1.o ${TMP}/a2.o
+ar rcs ${OUT}/libgroup_b.a ${TMP}/b1.o
@@ -0,0 +1,17 @@
+/* Built two ways (with -fcommon) for the COMMON symbol test.
+   common_merged is COMMON in both, with different sizes and alignments,
+   and common_overridden is COMMON in the first but defined in the
+   second. */
+
+#if defined(COMMON_A)
+int common_a;
+char common_merged[4];
+int common_overridden;
+
+int UseCommon(void) {
+  return common_a + common_merged[0] + common_overridden;
+}
+#elif defined(COMMON_B)
+double common_merged[8] __attribute__((aligned(32)));
+int common_overridden = 7;
+#endif
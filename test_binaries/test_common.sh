@@ -0,0 +1,15 @@
+#!/bin/bash
+
+# Set up the COMMON symbol test binaries from test_common.c:
+# test_common_a.o and test_common_b.o.
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_common.c
+readonly OUT=test_binaries/i686
+readonly CFLAGS="-m32 -O1 -fno-pic -fcommon -fno-asynchronous-unwind-tables -fno-stack-protector"
+
+gcc ${CFLAGS} -DCOMMON_A -c ${SRC} -o ${OUT}/test_common_a.o
+gcc ${CFLAGS} -DCOMMON_B -c ${SRC} -o ${OUT}/test_common_b.o
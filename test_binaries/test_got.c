@@ -0,0 +1,13 @@
+/* Exercises the GOT-based and PLT relocations that show up in -fPIC code. */
+
+static int local_counter = 1;
+int global_value = 42;
+int *global_ptr = &global_value;
+
+int GetGlobal(void) { return global_value + *global_ptr; }
+int GetLocal(void) { return ++local_counter; }
+int CallBoth(void) { return GetGlobal() + GetLocal(); }
+
+/* Never defined, so it stays 0 (and can't always be relaxed on x86-64). */
+extern int weak_missing __attribute__((weak));
+int GetWeak(void) { return &weak_missing ? weak_missing : 0; }
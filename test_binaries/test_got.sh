@@ -0,0 +1,18 @@
+#!/bin/bash
+
+# Set up GOT relocation test binaries from test_got.c.
+# These are built with the host gcc instead of the NaCl toolchain,
+# since the PNaCl translator does not generate GOT relocations.
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_got.c
+readonly CFLAGS="-O1 -fPIC -fno-asynchronous-unwind-tables -fno-stack-protector"
+
+# Keep the unrelaxed R_386_GOT32 for x86-32. For x86-64, this gives
+# both the relaxable R_X86_64_REX_GOTPCRELX and plain R_X86_64_GOTPCREL.
+gcc -m32 ${CFLAGS} -Wa,-mrelax-relocations=no -c ${SRC} \
+  -o test_binaries/i686/test_got.o
+gcc -m64 ${CFLAGS} -c ${SRC} -o test_binaries/x86_64/test_got.o
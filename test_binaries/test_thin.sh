@@ -0,0 +1,17 @@
+#!/bin/bash
+
+# Set up the thin archive test binary, from the other x86-32 test files.
+# Adding an archive to a thin archive makes the archive's members
+# members of the thin archive, so the nested archive offsets must match
+# the archives in the test directory. Rerun this when those change.
+# (libthin_all.a is an older thin archive, whose nested offsets no longer
+# match, so it is only used to check the file type and that error.)
+
+set -e
+set -u
+set -x
+
+cd test_binaries/i686
+rm -f libthin_nested.a
+ar rcsT libthin_nested.a crtbegin.o crtend.o libcrt_platform.a libgcc.a \
+    libpnacl_irt_shim.a
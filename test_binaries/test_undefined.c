@@ -0,0 +1,17 @@
+/* For the undefined reference diagnostics: missing_func and missing_var
+   are not defined anywhere, and maybe_missing is a weak reference. */
+
+extern int missing_var;
+extern void missing_func(void);
+extern void maybe_missing(void) __attribute__((weak));
+
+static void __attribute__((noinline)) helper(void) {
+  missing_func();
+}
+
+int undefined_main(void) {
+  helper();
+  if (maybe_missing)
+    maybe_missing();
+  return missing_var;
+}
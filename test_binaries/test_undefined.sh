@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# Set up the undefined reference test binary from test_undefined.c:
+# test_undefined.o.
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_undefined.c
+readonly OUT=test_binaries/i686
+readonly CFLAGS="-m32 -O1 -fno-pic -fno-asynchronous-unwind-tables -fno-stack-protector"
+
+gcc ${CFLAGS} -c ${SRC} -o ${OUT}/test_undefined.o
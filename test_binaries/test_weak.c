@@ -0,0 +1,31 @@
+/* Built several ways for the weak symbol test: the main object, which
+   has a weak definition of overridden, a weak reference to
+   maybe_missing (which nothing defines), and a weak reference to
+   weak_lib_func (which is only in libweak.a); an object with the
+   strong definition of overridden; and the libweak.a member. */
+
+#if defined(WEAK_MAIN)
+extern int maybe_missing(void) __attribute__((weak));
+extern int weak_lib_func(void) __attribute__((weak));
+
+int __attribute__((weak)) overridden(void) {
+  return 1;
+}
+
+int UseWeak(void) {
+  int result = overridden();
+  if (maybe_missing)
+    result += maybe_missing();
+  if (weak_lib_func)
+    result += weak_lib_func();
+  return result;
+}
+#elif defined(WEAK_STRONG)
+int overridden(void) {
+  return 2;
+}
+#elif defined(WEAK_LIB)
+int weak_lib_func(void) {
+  return 3;
+}
+#endif
@@ -0,0 +1,20 @@
+#!/bin/bash
+
+# Set up the weak symbol test binaries from test_weak.c:
+# test_weak_main.o, test_weak_strong.o, and libweak.a.
+
+set -e
+set -u
+set -x
+
+readonly SRC=test_binaries/test_weak.c
+readonly OUT=test_binaries/i686
+readonly CFLAGS="-m32 -O1 -fno-pic -fno-asynchronous-unwind-tables -fno-stack-protector"
+readonly TMP=$(mktemp -d)
+trap "rm -rf ${TMP}" EXIT
+
+gcc ${CFLAGS} -DWEAK_MAIN -c ${SRC} -o ${OUT}/test_weak_main.o
+gcc ${CFLAGS} -DWEAK_STRONG -c ${SRC} -o ${OUT}/test_weak_strong.o
+gcc ${CFLAGS} -DWEAK_LIB -c ${SRC} -o ${TMP}/weak_lib.o
+rm -f ${OUT}/libweak.a
+ar rcs ${OUT}/libweak.a ${TMP}/weak_lib.o